@@ -3,11 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
 	"log"
-	"net/http"
 )
 
 // ollama run llama3.2
@@ -21,26 +20,17 @@ func main() {
 }
 
 func run(ctx context.Context) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+	// the model is configured with LLM_CONFIG or the LLM_* environment variables, e.g. LLM_PROVIDER=openai LLM_MODEL=gpt-4
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: internalmodels.Ollama("llama3.2")})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	llm, err := ollama.New(
-		ollama.WithModel("llama3.2"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli))
+	llm, err := internalmodels.NewModel(cfg.Chat)
 	if err != nil {
-		return fmt.Errorf("ollama.New: %w", err)
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
 	}
 
-	//llm, err := openai.New(
-	//	openai.WithModel("gpt-4"),
-	//	openai.WithToken(os.Getenv("OPENAI_API_KEY")),
-	//)
-	//if err != nil {
-	//	return fmt.Errorf("openai.New: %w", err)
-	//}
-
 	content := []llms.MessageContent{
 		llms.TextParts(llms.ChatMessageTypeSystem, "You are a fellow Go developer."),
 		llms.TextParts(llms.ChatMessageTypeHuman, "Provide 3 short bullet points explaining why Go is awesome"),
@@ -61,8 +51,13 @@ func run(ctx context.Context) error {
 		}
 		fmt.Println(choice.Content)
 
-		if choice.StopReason != "" {
-			fmt.Println("Stop reason: ", choice.StopReason)
+		// Ollama does not report why it stopped, without a max tokens option a cut off answer is not detected.
+		switch reason := internalllms.ChoiceFinishReason(choice, 0); reason {
+		case internalllms.FinishUnknown:
+		case internalllms.FinishLength:
+			fmt.Println("Stop reason: ", reason, "(the answer is truncated)")
+		default:
+			fmt.Println("Stop reason: ", reason)
 		}
 	}
 
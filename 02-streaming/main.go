@@ -3,11 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
 	"log"
-	"net/http"
+	"os"
+	"time"
 )
 
 // ollama run llama3.2
@@ -21,41 +22,33 @@ func main() {
 }
 
 func run(ctx context.Context) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+	// the model is configured with LLM_CONFIG or the LLM_* environment variables, e.g. LLM_PROVIDER=openai LLM_MODEL=gpt-4
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: internalmodels.Ollama("llama3.2")})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	llm, err := ollama.New(
-		ollama.WithModel("llama3.2"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
+	llm, err := internalmodels.NewModel(cfg.Chat)
 	if err != nil {
-		return fmt.Errorf("ollama.New: %w", err)
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
 	}
 
-	//llm, err := openai.New(
-	//	openai.WithModel("gpt-4"),
-	//	openai.WithToken(os.Getenv("OPENAI_API_KEY")),
-	//	openai.WithHTTPClient(httpCli),
-	//)
-	//if err != nil {
-	//	return fmt.Errorf("openai.New: %w", err)
-	//}
-
 	content := []llms.MessageContent{
 		// does not work for "system" type with Ollama
 		llms.TextParts(llms.ChatMessageTypeHuman, "Give me a detailed and long explanation of why Testcontainers for Go is great"),
 	}
 
 	// Streaming is needed because models are usually slow in responding, so showing progress is important.
-	_, err = llm.GenerateContent(ctx, content, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-		fmt.Print(string(chunk))
-		return nil
-	}))
+	stream := internalllms.NewStreamAccumulator(internalllms.WithStreamWriter(os.Stdout))
+
+	result, err := stream.Generate(ctx, llm, content)
 	if err != nil {
-		return fmt.Errorf("llm.GenerateContent: %w", err)
+		return fmt.Errorf("stream.Generate: %w", err)
 	}
 
+	fmt.Printf("\n\ntime to first token: %s, %d tokens in %s, %.1f tokens/s\n",
+		result.TimeToFirstToken.Round(time.Millisecond), result.CompletionTokens,
+		result.Duration.Round(time.Millisecond), result.TokensPerSecond)
+
 	return nil
 }
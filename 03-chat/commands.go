@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nikolayk812/genai-go/internal/chat"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// errQuit is returned by a command to end the chat
+var errQuit = errors.New("quit")
+
+// command is a slash command of the chat, e.g. /model llama3.2
+type command struct {
+	name string
+	// args describes the arguments in /help, e.g. "<model>"
+	args string
+	help string
+	// run gets the rest of the line after the name, trimmed
+	run func(ctx context.Context, r *repl, args string) error
+}
+
+// registry holds the commands by name, without the slash
+type registry map[string]command
+
+func (reg registry) register(cmd command) {
+	reg[cmd.name] = cmd
+}
+
+// run runs the command of the line, its error is shown to the user and the chat goes on, unless it is errQuit
+func (reg registry) run(ctx context.Context, r *repl, line string) error {
+	name, args, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+
+	cmd, ok := reg[name]
+	if !ok {
+		return fmt.Errorf("unknown command /%s, type /help for the commands", name)
+	}
+
+	return cmd.run(ctx, r, strings.TrimSpace(args))
+}
+
+func (reg registry) help(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range slices.Sorted(maps.Keys(reg)) {
+		cmd := reg[name]
+		fmt.Fprintf(tw, "/%s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	tw.Flush()
+}
+
+func builtinCommands() registry {
+	reg := registry{}
+
+	reg.register(command{name: "help", help: "list the commands", run: func(ctx context.Context, r *repl, args string) error {
+		r.commands.help(r.out)
+		return nil
+	}})
+
+	reg.register(command{name: "quit", help: "end the chat, like quit, exit or bye", run: func(ctx context.Context, r *repl, args string) error {
+		return errQuit
+	}})
+
+	reg.register(command{name: "system", args: "[prompt]", help: "show or set the system prompt", run: runSystem})
+	reg.register(command{name: "model", args: "[model]", help: "show the model or switch to another one of the provider", run: runModel})
+	reg.register(command{name: "temp", args: "[temperature|default]", help: "show or set the temperature", run: runTemp})
+	reg.register(command{name: "seed", args: "[seed|default]", help: "show or set the seed", run: runSeed})
+	reg.register(command{name: "reset", help: "start a new session, keeping the system prompt", run: runReset})
+	reg.register(command{name: "undo", help: "drop your last message and its answer", run: runUndo})
+	reg.register(command{name: "retry", help: "drop the last answer and generate it again", run: runRetry})
+	reg.register(command{name: "save", args: "[title]", help: "save the session, with a new title if given", run: runSave})
+	reg.register(command{name: "load", args: "<id>", help: "continue a stored session, see sessions list", run: runLoad})
+	reg.register(command{name: "tokens", help: "show the token usage of the session and the room left in the context window", run: runTokens})
+
+	return reg
+}
+
+func runSystem(ctx context.Context, r *repl, args string) error {
+	if args == "" {
+		fmt.Fprintf(r.out, "System prompt: %q\n", r.session.System)
+		return nil
+	}
+
+	r.memory.SetSystem(args)
+	r.session.System = args
+
+	if err := r.store.Save(r.session); err != nil {
+		return fmt.Errorf("store.Save: %w", err)
+	}
+
+	fmt.Fprintln(r.out, "System prompt set")
+	return nil
+}
+
+func runModel(ctx context.Context, r *repl, args string) error {
+	if args == "" {
+		fmt.Fprintf(r.out, "Model %s of %s\n", r.cfg.Model, r.cfg.Provider)
+		return nil
+	}
+
+	cfg := r.cfg
+	cfg.Model = args
+	if err := r.setModel(cfg); err != nil {
+		return fmt.Errorf("setModel: %w", err)
+	}
+
+	if r.counter.ContextWindow() == 0 {
+		fmt.Fprintf(r.out, "Switched to %s, with an unknown context window\n", cfg.Model)
+		return nil
+	}
+	fmt.Fprintf(r.out, "Switched to %s, with a context window of %d tokens\n", cfg.Model, r.counter.ContextWindow())
+	return nil
+}
+
+func runTemp(ctx context.Context, r *repl, args string) error {
+	switch args {
+	case "":
+	case "default":
+		r.temperature = nil
+	default:
+		temperature, err := strconv.ParseFloat(args, 64)
+		if err != nil || temperature < 0 {
+			return fmt.Errorf("invalid temperature %q, want a number from 0", args)
+		}
+		r.temperature = &temperature
+	}
+
+	if r.temperature == nil {
+		fmt.Fprintln(r.out, "Temperature: model default")
+	} else {
+		fmt.Fprintf(r.out, "Temperature: %g\n", *r.temperature)
+	}
+	return nil
+}
+
+func runSeed(ctx context.Context, r *repl, args string) error {
+	switch args {
+	case "":
+	case "default":
+		r.seed = nil
+	default:
+		seed, err := strconv.Atoi(args)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q, want an integer", args)
+		}
+		r.seed = &seed
+	}
+
+	if r.seed == nil {
+		fmt.Fprintln(r.out, "Seed: model default")
+	} else {
+		fmt.Fprintf(r.out, "Seed: %d\n", *r.seed)
+	}
+	return nil
+}
+
+func runReset(ctx context.Context, r *repl, args string) error {
+	session := chat.NewSession("")
+	session.System = r.session.System
+
+	r.session = session
+	r.memory.Reset()
+
+	fmt.Fprintf(r.out, "New session %s\n", session.ID)
+	return nil
+}
+
+func runUndo(ctx context.Context, r *repl, args string) error {
+	text, ok := r.session.Undo()
+	if !ok {
+		return errors.New("nothing to undo")
+	}
+	r.memory.Undo()
+
+	if err := r.store.Save(r.session); err != nil {
+		return fmt.Errorf("store.Save: %w", err)
+	}
+
+	fmt.Fprintf(r.out, "Dropped %q and its answer\n", text)
+	return nil
+}
+
+func runRetry(ctx context.Context, r *repl, args string) error {
+	text, ok := r.session.Undo()
+	if !ok {
+		return errors.New("nothing to retry")
+	}
+	r.memory.Undo()
+
+	return r.turn(ctx, text)
+}
+
+func runSave(ctx context.Context, r *repl, args string) error {
+	if args != "" {
+		r.session.Title = args
+	}
+
+	if err := r.store.Save(r.session); err != nil {
+		return fmt.Errorf("store.Save: %w", err)
+	}
+
+	fmt.Fprintf(r.out, "Saved %q as %s\n", r.session.Title, r.session.ID)
+	return nil
+}
+
+func runLoad(ctx context.Context, r *repl, args string) error {
+	if args == "" {
+		return errors.New("usage: /load <id>")
+	}
+
+	session, err := r.store.Load(args)
+	if err != nil {
+		return fmt.Errorf("store.Load: %w", err)
+	}
+	r.load(session)
+
+	fmt.Fprintf(r.out, "Loaded %q with %d messages\n", session.Title, len(session.Turns))
+	return nil
+}
+
+func runTokens(ctx context.Context, r *repl, args string) error {
+	usage := r.session.Usage()
+	fmt.Fprintf(r.out, "Session: %d prompt and %d completion tokens\n", usage.PromptTokens, usage.CompletionTokens)
+
+	messages := r.memory.Messages()
+	if r.counter.ContextWindow() == 0 {
+		fmt.Fprintf(r.out, "Context: %d tokens, the context window of %s is unknown\n", r.counter.CountMessages(messages), r.cfg.Model)
+		return nil
+	}
+	fmt.Fprintf(r.out, "Context: %d of %d tokens, %d left for the answer\n",
+		r.counter.CountMessages(messages), r.counter.ContextWindow(), r.counter.Remaining(messages))
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/nikolayk812/genai-go/internal/chat"
+	"github.com/nikolayk812/genai-go/internal/fake"
+	"github.com/nikolayk812/genai-go/internal/fake/faketest"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func newTestREPL(t *testing.T) (*repl, *bytes.Buffer) {
+	t.Helper()
+
+	store, err := chat.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("chat.NewStore: %s", err)
+	}
+
+	var out bytes.Buffer
+	r, err := newREPL(internalmodels.ModelConfig{Provider: "fake", Model: "echo"}, "window", store, &out)
+	if err != nil {
+		t.Fatalf("newREPL: %s", err)
+	}
+
+	return r, &out
+}
+
+func TestCommands(t *testing.T) {
+	r, out := newTestREPL(t)
+	ctx := t.Context()
+
+	run := func(line string) {
+		t.Helper()
+		if err := r.commands.run(ctx, r, line); err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+	}
+
+	run("/system Answer in one word.")
+	run("/temp 0.2")
+	run("/seed 42")
+	if err := r.turn(ctx, "hello"); err != nil {
+		t.Fatalf("turn: %s", err)
+	}
+
+	model := r.llm.(*fake.Model)
+	call := faketest.LastCall(t, model)
+	if call.Options.Temperature != 0.2 || call.Options.Seed != 42 {
+		t.Fatalf("unexpected call options: %+v", call.Options)
+	}
+	faketest.RequireMessage(t, model, llms.ChatMessageTypeSystem, "Answer in one word.")
+
+	run("/retry")
+	faketest.RequireCalls(t, model, 2)
+	if len(r.session.Turns) != 2 || r.memory.Len() != 2 {
+		t.Fatalf("retry left %d turns and %d messages, want 2", len(r.session.Turns), r.memory.Len())
+	}
+
+	run("/undo")
+	if len(r.session.Turns) != 0 || r.memory.Len() != 0 {
+		t.Fatalf("undo left %d turns and %d messages", len(r.session.Turns), r.memory.Len())
+	}
+
+	if err := r.turn(ctx, "hello again"); err != nil {
+		t.Fatalf("turn: %s", err)
+	}
+	run("/save Greetings")
+	id := r.session.ID
+
+	run("/reset")
+	if r.session.ID == id || r.memory.Len() != 0 || r.session.System != "Answer in one word." {
+		t.Fatalf("unexpected session after reset: %+v", r.session)
+	}
+
+	run("/load " + id)
+	if r.session.Title != "Greetings" || r.memory.Len() != 2 {
+		t.Fatalf("unexpected loaded session: %+v", r.session)
+	}
+
+	run("/model other")
+	if r.cfg.Model != "other" || r.llm == llms.Model(model) {
+		t.Fatalf("model is not switched: %+v", r.cfg)
+	}
+
+	out.Reset()
+	run("/tokens")
+	if !strings.Contains(out.String(), "Context: ") {
+		t.Fatalf("unexpected tokens output: %q", out.String())
+	}
+
+	if err := r.commands.run(ctx, r, "/nope"); err == nil {
+		t.Fatalf("unknown command is accepted")
+	}
+}
+
+func TestCommands_register(t *testing.T) {
+	r, out := newTestREPL(t)
+
+	r.commands.register(command{name: "shout", help: "shout the argument", run: func(ctx context.Context, r *repl, args string) error {
+		_, err := r.out.Write([]byte(strings.ToUpper(args)))
+		return err
+	}})
+
+	if err := r.loop(t.Context(), strings.NewReader("/help\n/shout hi\nbye\n")); err != nil {
+		t.Fatalf("loop: %s", err)
+	}
+
+	for _, want := range []string{"/retry", "/shout", "HI", "Ending chat session"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output has no %q:\n%s", want, out.String())
+		}
+	}
+}
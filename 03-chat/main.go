@@ -1,87 +1,129 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"fmt"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	"github.com/nikolayk812/genai-go/internal/chat"
 	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"log"
-	"net/http"
+	"math"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
 )
 
+type options struct {
+	memory      string
+	resume      string
+	sessionsDir string
+	addr        string
+	idle        time.Duration
+}
+
 func main() {
+	var opts options
+	flag.StringVar(&opts.memory, "memory", "tokens", "how to keep the conversation within the context window: window, tokens or summary")
+	flag.StringVar(&opts.resume, "resume", "", "the ID of a stored session to continue")
+	flag.StringVar(&opts.sessionsDir, "sessions", "", "the directory of the stored sessions, in the user config directory by default")
+	flag.StringVar(&opts.addr, "addr", ":8080", "the address of the chat server")
+	flag.DurationVar(&opts.idle, "idle", 30*time.Minute, "how long the chat server keeps an idle session in memory")
+	flag.Usage = usage
+	flag.Parse()
+
 	ctx := context.Background()
 
-	if err := run(ctx); err != nil {
+	store, err := openStore(opts.sessionsDir)
+	if err != nil {
+		log.Fatalf("openStore: %s", err)
+	}
+
+	// go run . serve
+	if flag.Arg(0) == "serve" {
+		if err := serve(ctx, store, opts); err != nil {
+			log.Fatalf("serve: %s", err)
+		}
+		return
+	}
+
+	// go run . sessions list
+	if flag.NArg() > 0 {
+		if err := sessionsCommand(os.Stdout, store, flag.Args()); err != nil {
+			log.Fatalf("sessionsCommand: %s", err)
+		}
+		return
+	}
+
+	if err := run(ctx, store, opts); err != nil {
 		log.Fatalf("run: %s", err)
 	}
 }
 
-func run(ctx context.Context) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+func run(ctx context.Context, store *chat.Store, opts options) error {
+	// the model is configured with LLM_CONFIG or the LLM_* environment variables, e.g. LLM_PROVIDER=openai LLM_MODEL=gpt-4
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: internalmodels.Ollama("llama3.2")})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	llm, err := ollama.New(
-		ollama.WithModel("llama3.2"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
+	r, err := newREPL(cfg.Chat, opts.memory, store, os.Stdout)
 	if err != nil {
-		return fmt.Errorf("ollama.New: %w", err)
+		return fmt.Errorf("newREPL: %w", err)
 	}
 
-	// listen for interrupt signals to end the chat session gracefully
+	// the first interrupt cancels the answer in progress, a second one ends the chat
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	go func() {
-		<-sigChan
-		fmt.Println("\nInterrupt signal received, ending chat session")
-		os.Exit(0)
+		for sig := range sigChan {
+			if sig == syscall.SIGTERM || r.interrupt(time.Now()) {
+				cancel()
+				return
+			}
+		}
 	}()
 
-	var conversation []llms.MessageContent
-
-	reader := bufio.NewReader(os.Stdin)
-
-	// Enter a conversation loop
-	for {
-		fmt.Print("\nYou: ")
-		input, err := reader.ReadString('\n')
+	if opts.resume != "" {
+		session, err := store.Load(opts.resume)
 		if err != nil {
-			return fmt.Errorf("reader.ReadString: %w", err)
-		}
-
-		input = strings.TrimSpace(input)
-		switch input {
-		case "quit", "exit", "bye":
-			fmt.Println("Ending chat session")
-			os.Exit(0)
+			return fmt.Errorf("store.Load: %w", err)
 		}
+		r.load(session)
+		fmt.Printf("Resuming %q with %d messages\n", session.Title, len(session.Turns))
+	}
+	fmt.Printf("Session %s, continue it later with -resume %s\n", r.session.ID, r.session.ID)
+	fmt.Println("Type /help for the commands")
 
-		conversation = append(conversation, llms.TextParts(llms.ChatMessageTypeHuman, input))
+	return r.loop(ctx, os.Stdin)
+}
 
-		// TODO: skip earlier messages if context length is approaching the limit, or to save costs
-		// see: internalllms.TotalTokens(responses)
+// completionTokens is the room left for the answer of the model in the context window
+const completionTokens = 512
 
-		responses, err := llm.GenerateContent(ctx, conversation, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-			fmt.Print(string(chunk))
-			return nil
-		}))
-		if err != nil {
-			return fmt.Errorf("llm.GenerateContent: %w", err)
-		}
+func buildStrategy(name string, llm llms.Model, counter *internalllms.TokenCounter) (chat.Strategy, error) {
+	// a conversation with a model of unknown context window is not trimmed by the token strategies
+	maxTokens := math.MaxInt
+	if window := counter.ContextWindow(); window > 0 {
+		maxTokens = window - completionTokens
+	}
 
-		choiceContents := internalllms.ContentResponseToStrings(responses)
-		conversation = append(conversation, llms.TextParts(llms.ChatMessageTypeAI, choiceContents...))
+	switch name {
+	case "window":
+		return chat.SlidingWindow{Messages: 20}, nil
+	case "tokens":
+		return chat.TokenBudget{Counter: counter, MaxTokens: maxTokens}, nil
+	case "summary":
+		return chat.Summarize{Model: llm, Counter: counter, MaxTokens: maxTokens, KeepMessages: 6}, nil
+	default:
+		return nil, fmt.Errorf("unknown memory strategy %q", name)
 	}
 }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nikolayk812/genai-go/internal/chat"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// repl is the state of the chat, which the commands change between the turns
+type repl struct {
+	cfg      internalmodels.ModelConfig
+	strategy string
+	llm      llms.Model
+	counter  *internalllms.TokenCounter
+	memory   *chat.Memory
+	session  *chat.Session
+	store    *chat.Store
+	stream   *internalllms.StreamAccumulator
+	commands registry
+	out      io.Writer
+
+	// temperature and seed are sent with every call once set, the model defaults otherwise
+	temperature *float64
+	seed        *int
+
+	// mu guards the cancellation of the generation in progress, which interrupt calls from the signal handler
+	mu          sync.Mutex
+	cancelTurn  context.CancelFunc
+	interrupted time.Time
+}
+
+// interruptWindow is how soon a second interrupt must follow the first one to end the chat
+const interruptWindow = 2 * time.Second
+
+func newREPL(cfg internalmodels.ModelConfig, strategy string, store *chat.Store, out io.Writer) (*repl, error) {
+	r := &repl{
+		strategy: strategy,
+		memory:   chat.NewMemory(nil),
+		session:  chat.NewSession(""),
+		store:    store,
+		commands: builtinCommands(),
+		out:      out,
+		// the model sometimes goes on with the next turn of the user, cut it off
+		stream: internalllms.NewStreamAccumulator(
+			internalllms.WithStreamWriter(out),
+			internalllms.WithStopSequences("\nYou:"),
+		),
+	}
+
+	if err := r.setModel(cfg); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// setModel switches to the model of cfg, the conversation goes on with it
+func (r *repl) setModel(cfg internalmodels.ModelConfig) error {
+	llm, err := internalmodels.NewModel(cfg)
+	if err != nil {
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
+	}
+
+	counter := newCounter(cfg)
+
+	strategy, err := buildStrategy(r.strategy, llm, counter)
+	if err != nil {
+		return fmt.Errorf("buildStrategy: %w", err)
+	}
+
+	r.cfg, r.llm, r.counter = cfg, llm, counter
+	r.memory.SetStrategy(strategy)
+
+	return nil
+}
+
+func newCounter(cfg internalmodels.ModelConfig) *internalllms.TokenCounter {
+	// Ollama serves the models with OllamaContextWindow unless num_ctx is set
+	var counterOpts []internalllms.TokenCounterOption
+	if cfg.Provider == "ollama" {
+		counterOpts = append(counterOpts, internalllms.WithContextWindow(cmp.Or(cfg.ContextWindow, internalllms.OllamaContextWindow)))
+	}
+	return internalllms.NewTokenCounter(cfg.Model, counterOpts...)
+}
+
+// load continues a stored session
+func (r *repl) load(session *chat.Session) {
+	r.session = session
+	r.memory.Reset()
+	r.memory.SetSystem(session.System)
+	r.memory.Add(session.Messages()...)
+}
+
+func (r *repl) callOptions() []llms.CallOption {
+	var opts []llms.CallOption
+	if r.temperature != nil {
+		opts = append(opts, llms.WithTemperature(*r.temperature))
+	}
+	if r.seed != nil {
+		opts = append(opts, llms.WithSeed(*r.seed))
+	}
+	return opts
+}
+
+// loop reads the input line by line, running the commands and answering the rest, until /quit,
+// the end of the input or the cancellation of ctx. The session is saved before it returns.
+func (r *repl) loop(ctx context.Context, in io.Reader) error {
+	readCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// the input is read aside, so a cancellation does not wait for the next line
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case lines <- line:
+			case <-readCtx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		if ctx.Err() != nil {
+			return r.end()
+		}
+
+		fmt.Fprint(r.out, "\nYou: ")
+
+		var input string
+		select {
+		case input = <-lines:
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return r.end()
+			}
+			return fmt.Errorf("reader.ReadString: %w", err)
+		case <-ctx.Done():
+			return r.end()
+		}
+
+		input = strings.TrimSpace(input)
+		switch input {
+		case "":
+			continue
+		case "quit", "exit", "bye":
+			input = "/quit"
+		}
+
+		if strings.HasPrefix(input, "/") {
+			err := r.commands.run(ctx, r, input)
+			if errors.Is(err, errQuit) {
+				return r.end()
+			}
+			if err != nil {
+				fmt.Fprintln(r.out, err)
+			}
+			continue
+		}
+
+		if err := r.turn(ctx, input); err != nil {
+			return err
+		}
+	}
+}
+
+// end saves the session, unless it is empty
+func (r *repl) end() error {
+	fmt.Fprintln(r.out, "\nEnding chat session")
+
+	if len(r.session.Turns) == 0 {
+		return nil
+	}
+
+	if err := r.store.Save(r.session); err != nil {
+		return fmt.Errorf("store.Save: %w", err)
+	}
+
+	return nil
+}
+
+// interrupt cancels the generation in progress. It reports whether to end the chat instead,
+// when no generation is in progress or the previous interrupt was less than interruptWindow ago.
+func (r *repl) interrupt(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancelTurn == nil || now.Sub(r.interrupted) < interruptWindow {
+		return true
+	}
+
+	r.cancelTurn()
+	r.interrupted = now
+	return false
+}
+
+func (r *repl) setCancelTurn(cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cancelTurn = cancel
+}
+
+// turn sends the input with the conversation to the model, streams the answer and saves the session.
+// An interrupted answer is kept as far as it got.
+func (r *repl) turn(ctx context.Context, input string) error {
+	turnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r.setCancelTurn(cancel)
+	defer r.setCancelTurn(nil)
+
+	r.memory.Add(llms.TextParts(llms.ChatMessageTypeHuman, input))
+	r.session.AddUser(input)
+
+	report, err := r.memory.Trim(turnCtx)
+	if err != nil && turnCtx.Err() != nil {
+		// interrupted while summarizing, before anything was generated
+		r.memory.Undo()
+		r.session.Undo()
+		r.printInterrupted(ctx)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("memory.Trim: %w", err)
+	}
+	if !report.IsZero() {
+		fmt.Fprintf(r.out, "(%s to fit the context window)\n", report)
+	}
+
+	result, err := r.stream.Generate(turnCtx, r.llm, r.memory.Messages(), r.callOptions()...)
+	switch {
+	case err != nil && turnCtx.Err() != nil:
+		r.printInterrupted(ctx)
+		r.memory.Add(llms.TextParts(llms.ChatMessageTypeAI, result.Text))
+		r.session.AddInterrupted(result.Text, r.cfg.Model)
+	case err != nil:
+		return fmt.Errorf("stream.Generate: %w", err)
+	default:
+		r.memory.Add(llms.TextParts(llms.ChatMessageTypeAI, result.Text))
+		r.session.AddModel(result.Text, r.cfg.Model, internalllms.ResponseUsage(result.Response))
+	}
+
+	if err := r.store.Save(r.session); err != nil {
+		return fmt.Errorf("store.Save: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repl) printInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		// the chat is ending
+		fmt.Fprintln(r.out, "\n(interrupted)")
+		return
+	}
+	fmt.Fprintln(r.out, "\n(interrupted, press Ctrl+C again to end the chat)")
+}
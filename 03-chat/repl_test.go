@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"github.com/nikolayk812/genai-go/internal/fake"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestREPL_interrupt(t *testing.T) {
+	r, out := newTestREPL(t)
+	r.llm = fake.NewModel(fake.WithEcho(), fake.WithChunkSize(1), fake.WithChunkDelay(10*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.turn(t.Context(), "tell me a long story about the sea")
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	now := time.Now()
+	if r.interrupt(now) {
+		t.Fatalf("first interrupt ends the chat")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("turn: %s", err)
+	}
+
+	last := r.session.Turns[len(r.session.Turns)-1]
+	if !last.Interrupted || last.Text == "" || len(last.Text) >= len("tell me a long story about the sea") {
+		t.Fatalf("unexpected interrupted turn: %+v", last)
+	}
+	if r.memory.Len() != 2 || !strings.Contains(out.String(), "(interrupted, press Ctrl+C again") {
+		t.Fatalf("partial answer is not kept, output:\n%s", out.String())
+	}
+
+	stored, err := r.store.Load(r.session.ID)
+	if err != nil || len(stored.Turns) != 2 {
+		t.Fatalf("session is not saved: %v", err)
+	}
+
+	if !r.interrupt(now.Add(time.Second)) {
+		t.Fatalf("second interrupt does not end the chat")
+	}
+}
+
+func TestREPL_loopCancelled(t *testing.T) {
+	r, out := newTestREPL(t)
+
+	// the input never ends, the loop must not wait for it
+	in, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- r.loop(ctx, in)
+	}()
+
+	if _, err := io.WriteString(w, "hello\n"); err != nil {
+		t.Fatalf("io.WriteString: %s", err)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("loop: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("loop does not end on cancellation")
+	}
+
+	if !strings.Contains(out.String(), "Ending chat session") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+}
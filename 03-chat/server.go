@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nikolayk812/genai-go/internal/chat"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// chatRequest is the body of POST /chat, an empty SessionID starts a new session
+type chatRequest struct {
+	SessionID string `json:"session_id"`
+	Message   string `json:"message"`
+	// System sets the system prompt of the session, it is kept when empty
+	System string `json:"system"`
+}
+
+// server serves the chat over HTTP. POST /chat answers a message of a session with Server-Sent Events:
+// a session event with the session ID, token events with the streamed text, and a done event with the
+// finish reason and the usage, or an error event.
+type server struct {
+	llm      llms.Model
+	model    string
+	strategy chat.Strategy
+	store    *chat.Store
+	// idle is how long a session is kept in memory after its last message, it is loaded again from the store
+	idle time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*liveSession
+}
+
+// liveSession is a session in memory, it answers one message at a time
+type liveSession struct {
+	mu       sync.Mutex
+	memory   *chat.Memory
+	session  *chat.Session
+	lastUsed time.Time
+}
+
+func newServer(llm llms.Model, model string, strategy chat.Strategy, store *chat.Store, idle time.Duration) *server {
+	return &server{
+		llm:      llm,
+		model:    model,
+		strategy: strategy,
+		store:    store,
+		idle:     idle,
+		sessions: map[string]*liveSession{},
+	}
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat", s.handleChat)
+	return mux
+}
+
+// session returns the session in memory, loading it from the store after its expiry, or a new session for an empty ID
+func (s *server) session(id string) (*liveSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if live, ok := s.sessions[id]; ok {
+		live.lastUsed = time.Now()
+		return live, nil
+	}
+
+	live := &liveSession{memory: chat.NewMemory(s.strategy), lastUsed: time.Now()}
+	if id == "" {
+		live.session = chat.NewSession("")
+	} else {
+		session, err := s.store.Load(id)
+		if err != nil {
+			return nil, fmt.Errorf("store.Load: %w", err)
+		}
+		live.session = session
+		live.memory.SetSystem(session.System)
+		live.memory.Add(session.Messages()...)
+	}
+
+	s.sessions[live.session.ID] = live
+	return live, nil
+}
+
+// expire drops the sessions idle since before now less the idle timeout, unless they are answering
+func (s *server) expire(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, live := range s.sessions {
+		if now.Sub(live.lastUsed) < s.idle || !live.mu.TryLock() {
+			continue
+		}
+		delete(s.sessions, id)
+		live.mu.Unlock()
+	}
+}
+
+// expireIdle calls expire every interval until ctx is done
+func (s *server) expireIdle(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.expire(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		http.Error(w, "empty message", http.StatusBadRequest)
+		return
+	}
+
+	live, err := s.session(req.SessionID)
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !live.mu.TryLock() {
+		http.Error(w, "the session is answering another message", http.StatusConflict)
+		return
+	}
+	defer live.mu.Unlock()
+
+	events, err := newEventWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := events.send("session", map[string]string{"session_id": live.session.ID}); err != nil {
+		// the client is gone before anything was generated
+		log.Printf("session %s: events.send: %s", live.session.ID, err)
+		return
+	}
+	if r.Context().Err() != nil {
+		return
+	}
+
+	if req.System != "" {
+		live.memory.SetSystem(req.System)
+		live.session.System = req.System
+	}
+
+	if err := s.turn(r.Context(), live, req.Message, events); err != nil {
+		log.Printf("session %s: %s", live.session.ID, err)
+		if err := events.send("error", map[string]string{"error": err.Error()}); err != nil {
+			log.Printf("session %s: events.send: %s", live.session.ID, err)
+		}
+	}
+}
+
+// turn answers the message like the turn of the REPL, an answer interrupted by the client is kept as far as it got
+func (s *server) turn(ctx context.Context, live *liveSession, message string, events *eventWriter) error {
+	live.memory.Add(llms.TextParts(llms.ChatMessageTypeHuman, message))
+	live.session.AddUser(message)
+
+	if _, err := live.memory.Trim(ctx); err != nil {
+		live.memory.Undo()
+		live.session.Undo()
+		return fmt.Errorf("memory.Trim: %w", err)
+	}
+
+	stream := internalllms.NewStreamAccumulator(
+		internalllms.WithStreamWriter(tokenWriter{events}),
+		internalllms.WithStopSequences("\nYou:"),
+	)
+
+	result, err := stream.Generate(ctx, s.llm, live.memory.Messages())
+	switch {
+	case err != nil && (ctx.Err() != nil || events.err != nil):
+		// the client is gone, there is nobody to tell
+		live.memory.Add(llms.TextParts(llms.ChatMessageTypeAI, result.Text))
+		live.session.AddInterrupted(result.Text, s.model)
+		if err := s.store.Save(live.session); err != nil {
+			log.Printf("session %s: store.Save: %s", live.session.ID, err)
+		}
+		return nil
+	case err != nil:
+		live.memory.Undo()
+		live.session.Undo()
+		return fmt.Errorf("stream.Generate: %w", err)
+	}
+
+	usage := internalllms.ResponseUsage(result.Response)
+	live.memory.Add(llms.TextParts(llms.ChatMessageTypeAI, result.Text))
+	live.session.AddModel(result.Text, s.model, usage)
+
+	if err := s.store.Save(live.session); err != nil {
+		return fmt.Errorf("store.Save: %w", err)
+	}
+
+	if err := events.send("done", map[string]any{
+		"finish_reason": internalllms.ResponseFinishReason(result.Response, nil, 0),
+		"usage":         usage,
+	}); err != nil {
+		// the answer is saved, only its end is not delivered
+		log.Printf("session %s: events.send: %s", live.session.ID, err)
+	}
+
+	return nil
+}
+
+// eventWriter writes Server-Sent Events with JSON data, flushing each one
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	// err is the first write error, after which nothing is written
+	err error
+}
+
+func newEventWriter(w http.ResponseWriter) (*eventWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventWriter{w: w, flusher: flusher}, nil
+}
+
+func (e *eventWriter) send(event string, data any) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		e.err = fmt.Errorf("fmt.Fprintf: %w", err)
+		return e.err
+	}
+	e.flusher.Flush()
+
+	return nil
+}
+
+// tokenWriter is the stream writer of the StreamAccumulator, sending every chunk as a token event
+type tokenWriter struct {
+	events *eventWriter
+}
+
+func (t tokenWriter) Write(p []byte) (int, error) {
+	if err := t.events.send("token", map[string]string{"text": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// serve runs the chat server until an interrupt, the in-flight answers are cancelled and kept as interrupted
+func serve(ctx context.Context, store *chat.Store, opts options) error {
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: internalmodels.Ollama("llama3.2")})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
+	}
+
+	llm, err := internalmodels.NewModel(cfg.Chat)
+	if err != nil {
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
+	}
+
+	strategy, err := buildStrategy(opts.memory, llm, newCounter(cfg.Chat))
+	if err != nil {
+		return fmt.Errorf("buildStrategy: %w", err)
+	}
+
+	srv := newServer(llm, cfg.Chat.Model, strategy, store, opts.idle)
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go srv.expireIdle(ctx, time.Minute)
+
+	httpSrv := &http.Server{
+		Addr:              opts.addr,
+		Handler:           srv.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// the requests are cancelled with ctx, so the answers in progress end on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	log.Printf("Serving %s of %s on %s, POST /chat", cfg.Chat.Model, cfg.Chat.Provider, opts.addr)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpSrv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("httpSrv.ListenAndServe: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Shutdown returns once the handlers are done, so the interrupted answers are saved before the exit
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("httpSrv.Shutdown: %w", err)
+	}
+
+	return nil
+}
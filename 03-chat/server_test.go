@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/nikolayk812/genai-go/internal/chat"
+	"github.com/nikolayk812/genai-go/internal/fake"
+	"github.com/nikolayk812/genai-go/internal/fake/faketest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+type event struct {
+	name string
+	data map[string]any
+}
+
+func newTestServer(t *testing.T, model *fake.Model) (*server, *httptest.Server) {
+	t.Helper()
+
+	store, err := chat.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("chat.NewStore: %s", err)
+	}
+
+	srv := newServer(model, "fake", chat.SlidingWindow{Messages: 20}, store, time.Minute)
+	httpSrv := httptest.NewServer(srv.handler())
+	t.Cleanup(httpSrv.Close)
+
+	return srv, httpSrv
+}
+
+func postChat(t *testing.T, ctx context.Context, url string, req chatRequest) *http.Response {
+	t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/chat", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("http.Do: %s", err)
+	}
+
+	return resp
+}
+
+// readEvents reads the events of the stream until its end, or until stop returns true
+func readEvents(t *testing.T, resp *http.Response, stop func(event) bool) []event {
+	t.Helper()
+
+	var events []event
+	var current event
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.data); err != nil {
+				t.Fatalf("json.Unmarshal: %s", err)
+			}
+		case line == "":
+			events = append(events, current)
+			if stop != nil && stop(current) {
+				return events
+			}
+			current = event{}
+		}
+	}
+
+	return events
+}
+
+func TestServer_chat(t *testing.T) {
+	model := fake.NewModel().
+		OnPrompt("What is the capital of Japan?", fake.Text("The capital of Japan is Tokyo.")).
+		OnPrompt("And of France?", fake.Text("Paris."))
+	_, httpSrv := newTestServer(t, model)
+
+	resp := postChat(t, t.Context(), httpSrv.URL, chatRequest{Message: "What is the capital of Japan?", System: "Be brief."})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := readEvents(t, resp, nil)
+	if len(events) < 3 || events[0].name != "session" || events[len(events)-1].name != "done" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	var text strings.Builder
+	for _, e := range events[1 : len(events)-1] {
+		if e.name != "token" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+		text.WriteString(e.data["text"].(string))
+	}
+	if text.String() != "The capital of Japan is Tokyo." || events[len(events)-1].data["finish_reason"] != "stop" {
+		t.Fatalf("unexpected answer %q, done: %+v", text.String(), events[len(events)-1])
+	}
+
+	// the next message of the session is sent with the conversation
+	sessionID := events[0].data["session_id"].(string)
+	resp = postChat(t, t.Context(), httpSrv.URL, chatRequest{SessionID: sessionID, Message: "And of France?"})
+	defer resp.Body.Close()
+	readEvents(t, resp, nil)
+
+	faketest.RequireMessage(t, model, llms.ChatMessageTypeSystem, "Be brief.")
+	faketest.RequireMessage(t, model, llms.ChatMessageTypeAI, "Tokyo")
+	faketest.RequireScriptsUsed(t, model)
+}
+
+func TestServer_disconnect(t *testing.T) {
+	model := fake.NewModel(fake.WithChunkSize(1), fake.WithChunkDelay(20*time.Millisecond)).
+		Enqueue(fake.Text("Once upon a time, there was a fisherman who lived by the sea."))
+	srv, httpSrv := newTestServer(t, model)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	resp := postChat(t, ctx, httpSrv.URL, chatRequest{Message: "Tell me a story."})
+
+	// hang up after the first tokens
+	tokens := 0
+	events := readEvents(t, resp, func(e event) bool {
+		if e.name == "token" {
+			tokens++
+		}
+		return tokens == 3
+	})
+	cancel()
+	resp.Body.Close()
+
+	live, err := srv.session(events[0].data["session_id"].(string))
+	if err != nil {
+		t.Fatalf("session: %s", err)
+	}
+
+	// the handler holds the session until the generation is cancelled
+	live.mu.Lock()
+	defer live.mu.Unlock()
+
+	last := live.session.Turns[len(live.session.Turns)-1]
+	if !last.Interrupted || !strings.HasPrefix(last.Text, "Onc") || strings.HasSuffix(last.Text, "sea.") {
+		t.Fatalf("unexpected interrupted turn: %+v", last)
+	}
+}
+
+func TestServer_expire(t *testing.T) {
+	model := fake.NewModel(fake.WithEcho())
+	srv, httpSrv := newTestServer(t, model)
+
+	resp := postChat(t, t.Context(), httpSrv.URL, chatRequest{Message: "hello"})
+	events := readEvents(t, resp, nil)
+	resp.Body.Close()
+	sessionID := events[0].data["session_id"].(string)
+
+	srv.expire(time.Now().Add(time.Hour))
+	if len(srv.sessions) != 0 {
+		t.Fatalf("%d sessions are not expired", len(srv.sessions))
+	}
+
+	// an expired session is loaded from the store
+	resp = postChat(t, t.Context(), httpSrv.URL, chatRequest{SessionID: sessionID, Message: "hello again"})
+	readEvents(t, resp, nil)
+	resp.Body.Close()
+
+	if messages := faketest.LastCall(t, model).Messages; len(messages) != 3 {
+		t.Fatalf("expired session is resumed with %d messages, want 3", len(messages))
+	}
+
+	resp = postChat(t, t.Context(), httpSrv.URL, chatRequest{SessionID: "unknown", Message: "hello"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown session status is %d, want 404", resp.StatusCode)
+	}
+}
+
+// goneWriter fails the writes, like the connection of a client which hung up
+type goneWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (goneWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestServer_clientGone(t *testing.T) {
+	model := fake.NewModel(fake.WithEcho())
+	srv, _ := newTestServer(t, model)
+
+	req := httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(`{"message": "hello"}`))
+	srv.handler().ServeHTTP(goneWriter{httptest.NewRecorder()}, req)
+
+	faketest.RequireCalls(t, model, 0)
+}
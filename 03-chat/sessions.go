@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/nikolayk812/genai-go/internal/chat"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, `Usage:
+  go run . [flags]                  chat, in a new session or a resumed one
+  go run . [flags] serve            serve the chat over HTTP, POST /chat
+  go run . [flags] sessions list    list the stored sessions
+  go run . [flags] sessions rename <id> <title>
+  go run . [flags] sessions delete <id>
+  go run . [flags] sessions export <id> [md|jsonl]
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func openStore(dir string) (*chat.Store, error) {
+	if dir == "" {
+		var err error
+		if dir, err = chat.DefaultStoreDir(); err != nil {
+			return nil, fmt.Errorf("chat.DefaultStoreDir: %w", err)
+		}
+	}
+
+	store, err := chat.NewStore(dir)
+	if err != nil {
+		return nil, fmt.Errorf("chat.NewStore: %w", err)
+	}
+
+	return store, nil
+}
+
+// sessionsCommand runs the "sessions" command line
+func sessionsCommand(w io.Writer, store *chat.Store, args []string) error {
+	if args[0] != "sessions" || len(args) < 2 {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+	}
+
+	switch command, args := args[1], args[2:]; {
+	case command == "list" && len(args) == 0:
+		infos, err := store.List()
+		if err != nil {
+			return fmt.Errorf("store.List: %w", err)
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUPDATED\tMESSAGES\tTITLE")
+		for _, info := range infos {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", info.ID, info.UpdatedAt.Local().Format(time.DateTime), info.Turns, info.Title)
+		}
+		return tw.Flush()
+
+	case command == "rename" && len(args) >= 2:
+		if err := store.Rename(args[0], strings.Join(args[1:], " ")); err != nil {
+			return fmt.Errorf("store.Rename: %w", err)
+		}
+		return nil
+
+	case command == "delete" && len(args) == 1:
+		if err := store.Delete(args[0]); err != nil {
+			return fmt.Errorf("store.Delete: %w", err)
+		}
+		return nil
+
+	case command == "export" && (len(args) == 1 || len(args) == 2):
+		session, err := store.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("store.Load: %w", err)
+		}
+
+		format := "md"
+		if len(args) == 2 {
+			format = args[1]
+		}
+
+		switch format {
+		case "md":
+			return session.WriteMarkdown(w)
+		case "jsonl":
+			return session.WriteJSONL(w)
+		default:
+			return fmt.Errorf("unknown export format %q, want md or jsonl", format)
+		}
+
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", strings.Join(append([]string{"sessions", command}, args...), " "))
+	}
+}
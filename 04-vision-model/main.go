@@ -4,11 +4,9 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
-	"github.com/tmc/langchaingo/llms/ollama"
-	"github.com/tmc/langchaingo/llms/openai"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"log"
-	"net/http"
 	"os"
 
 	"github.com/tmc/langchaingo/llms"
@@ -20,41 +18,27 @@ var catImage []byte
 func main() {
 	ctx := context.Background()
 
-	if err := run(ctx, true); err != nil {
+	if err := run(ctx); err != nil {
 		log.Fatalf("run: %s", err)
 	}
 }
 
-func run(ctx context.Context, useOllama bool) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
-	}
-
-	var llm llms.Model
-
-	llm, err := ollama.New(
-		ollama.WithModel("moondream:1.8b"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
+func run(ctx context.Context) error {
+	// the model is configured with LLM_CONFIG or the LLM_* environment variables,
+	// e.g. LLM_PROVIDER=openai LLM_MODEL=gpt-4-turbo
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: internalmodels.Ollama("moondream:1.8b")})
 	if err != nil {
-		return fmt.Errorf("ollama.New: %w", err)
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	if !useOllama {
-		llm, err = openai.New(
-			openai.WithModel("gpt-4-turbo"),
-			openai.WithToken(os.Getenv("OPENAI_API_KEY")),
-			openai.WithHTTPClient(httpCli),
-		)
-		if err != nil {
-			return fmt.Errorf("openai.New: %w", err)
-		}
+	llm, err := internalmodels.NewModel(cfg.Chat)
+	if err != nil {
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
 	}
 
 	var content []llms.MessageContent
 
-	imagePart := imagePart(useOllama)
+	imagePart := imagePart(cfg.Chat.Provider == "ollama")
 
 	content = append(content, llms.MessageContent{
 		Role: llms.ChatMessageTypeHuman,
@@ -64,12 +48,9 @@ func run(ctx context.Context, useOllama bool) error {
 		},
 	})
 
-	_, err = llm.GenerateContent(ctx, content, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-		fmt.Print(string(chunk))
-		return nil
-	}))
-	if err != nil {
-		return fmt.Errorf("llm.GenerateContent: %w", err)
+	stream := internalllms.NewStreamAccumulator(internalllms.WithStreamWriter(os.Stdout))
+	if _, err := stream.Generate(ctx, llm, content); err != nil {
+		return fmt.Errorf("stream.Generate: %w", err)
 	}
 
 	return nil
@@ -3,13 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
 	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"log"
-	"net/http"
 
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
 )
 
 func main() {
@@ -21,17 +19,15 @@ func main() {
 }
 
 func run(ctx context.Context) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+	// the model is configured with LLM_CONFIG or the LLM_* environment variables, e.g. LLM_PROVIDER=openai LLM_MODEL=gpt-4
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: internalmodels.Ollama("llama3.2")})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	llm, err := ollama.New(
-		ollama.WithModel("llama3.2"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
+	llm, err := internalmodels.NewModel(cfg.Chat)
 	if err != nil {
-		return fmt.Errorf("ollama.New: %w", err)
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
 	}
 
 	originalMessage := `
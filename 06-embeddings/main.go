@@ -4,11 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/chewxy/math32"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"github.com/tmc/langchaingo/embeddings"
-	"github.com/tmc/langchaingo/llms/ollama"
 	"log"
-	"net/http"
 )
 
 func main() {
@@ -27,28 +25,18 @@ func main() {
 }
 
 func run(ctx context.Context, docs []string) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+	// the model is configured with LLM_CONFIG or the LLM_EMBEDDING_* environment variables,
+	// e.g. LLM_EMBEDDING_PROVIDER=openai LLM_EMBEDDING_MODEL=text-embedding-3-small
+	cfg, err := internalmodels.Load(internalmodels.Config{Embedding: internalmodels.Ollama("nomic-embed-text:v1.5")})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	llm, err := ollama.New(
-		ollama.WithModel("nomic-embed-text:v1.5"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
+	llm, err := internalmodels.NewEmbedder(cfg.Embedding)
 	if err != nil {
-		return fmt.Errorf("ollama.New: %w", err)
+		return fmt.Errorf("internalmodels.NewEmbedder: %w", err)
 	}
 
-	//llm, err := openai.New(
-	//	openai.WithModel("text-embedding-3-small"),
-	//	openai.WithToken(os.Getenv("OPENAI_API_KEY")),
-	//	openai.WithHTTPClient(httpCli),
-	//)
-	//if err != nil {
-	//	return fmt.Errorf("openai.New: %w", err)
-	//}
-
 	embedder, err := embeddings.NewEmbedder(llm)
 	if err != nil {
 		return fmt.Errorf("embeddings.NewEmbedder: %w", err)
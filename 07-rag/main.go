@@ -3,14 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
-	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"github.com/tmc/langchaingo/vectorstores/weaviate"
 	"log"
-	"net/http"
+	"os"
 
 	"github.com/tmc/langchaingo/embeddings"
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/ollama"
 	"github.com/tmc/langchaingo/schema"
 	"github.com/tmc/langchaingo/vectorstores"
 )
@@ -24,13 +24,18 @@ func main() {
 }
 
 func run(ctx context.Context) error {
-	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+	// the models are configured with LLM_CONFIG or the LLM_* and LLM_EMBEDDING_* environment variables
+	cfg, err := internalmodels.Load(internalmodels.Config{
+		Chat:      internalmodels.Ollama("llama3.2"),
+		Embedding: internalmodels.Ollama("nomic-embed-text:v1.5"),
+	})
+	if err != nil {
+		return fmt.Errorf("internalmodels.Load: %w", err)
 	}
 
-	embeddingLLM, err := buildEmbeddingModel(httpCli)
+	embeddingLLM, err := internalmodels.NewEmbedder(cfg.Embedding)
 	if err != nil {
-		return fmt.Errorf("buildEmbeddingModel: %w", err)
+		return fmt.Errorf("internalmodels.NewEmbedder: %w", err)
 	}
 
 	embedder, err := embeddings.NewEmbedder(embeddingLLM)
@@ -67,9 +72,9 @@ func run(ctx context.Context) error {
 		return nil
 	}
 
-	chatLLM, err := buildChatModel(httpCli)
+	chatLLM, err := internalmodels.NewModel(cfg.Chat)
 	if err != nil {
-		return fmt.Errorf("build chat model: %w", err)
+		return fmt.Errorf("internalmodels.NewModel: %w", err)
 	}
 
 	raggedQuestion := fmt.Sprintf(`
@@ -86,46 +91,17 @@ Answer the question considering the following relevant content, be very confiden
 		llms.TextParts(llms.ChatMessageTypeHuman, raggedQuestion),
 	}
 
-	if _, err := chatLLM.GenerateContent(ctx, raggedContent,
+	stream := internalllms.NewStreamAccumulator(internalllms.WithStreamWriter(os.Stdout))
+	if _, err := stream.Generate(ctx, chatLLM, raggedContent,
 		llms.WithTemperature(0.0001),
 		llms.WithTopK(1),
-		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-			fmt.Print(string(chunk))
-			return nil
-		}),
 	); err != nil {
-		return fmt.Errorf("chatLLM.GenerateContent: %w", err)
+		return fmt.Errorf("stream.Generate: %w", err)
 	}
 
 	return nil
 }
 
-func buildChatModel(httpCli *http.Client) (llms.Model, error) {
-	llm, err := ollama.New(
-		ollama.WithModel("llama3.2"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("ollama.New: %w", err)
-	}
-
-	return llm, nil
-}
-
-func buildEmbeddingModel(httpCli *http.Client) (embeddings.EmbedderClient, error) {
-	llm, err := ollama.New(
-		ollama.WithModel("nomic-embed-text:v1.5"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("ollama.New: %w", err)
-	}
-
-	return llm, nil
-}
-
 func buildEmbeddingStore(embedder embeddings.Embedder) (vectorstores.VectorStore, error) {
 
 	//docker run -d --name chroma \
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/nikolayk812/genai-go/internal/tracing"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/schema"
 )
@@ -67,7 +68,12 @@ Follow these instructions:
 // Chat creates a chat response from the user message.
 // If there is a RAG context in the form of relevant documents, it will be added to the prompt
 // as system messages.
-func (s *ChatService) Chat(ctx context.Context, userMessage string) (string, error) {
+func (s *ChatService) Chat(ctx context.Context, userMessage string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "ChatService.Chat")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	// Ollama ignores system, use human instead
 	systemType := llms.ChatMessageTypeHuman
 
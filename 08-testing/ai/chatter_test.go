@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+// TestChatService_faults runs offline against a fake Ollama server, every fault must surface as an error
+func TestChatService_faults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Football"},"done_reason":"stop","done":true,"eval_count":8}`+"\n")
+	}))
+	defer srv.Close()
+
+	tests := map[string]internalhttp.ChaosProfile{
+		"status 500":      {StatusRate: 1},
+		"connection":      {ErrorRate: 1},
+		"corrupted frame": {CorruptFrameRate: 1},
+		"error frame":     {ErrorFrameRate: 1},
+		"truncated":       {TruncateRate: 1, TruncateAfterBytes: 20},
+		"dropped":         {DropRate: 1, DropAfterBytes: 20},
+		"slow":            {Latency: time.Second},
+	}
+
+	for name, profile := range tests {
+		t.Run(name, func(t *testing.T) {
+			llm, err := ollama.New(
+				ollama.WithModel("llama3.2"),
+				ollama.WithServerURL(srv.URL),
+				ollama.WithHTTPClient(&http.Client{Transport: internalhttp.NewChaosRoundTripper(profile, nil)}),
+			)
+			if err != nil {
+				t.Fatalf("ollama.New: %s", err)
+			}
+
+			ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+			defer cancel()
+
+			answer, err := NewChat(llm).Chat(ctx, "What is my favorite sport?")
+			if err == nil {
+				t.Fatalf("Chat answered %q, want an error", answer)
+			}
+		})
+	}
+}
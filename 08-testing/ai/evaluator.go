@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
 	"github.com/tmc/langchaingo/llms"
 )
 
@@ -59,6 +60,12 @@ Reference: %s
 `
 )
 
+// Evaluation is the structured response of the evaluator, its JSON Schema is derived from the tags
+type Evaluation struct {
+	Response string `json:"response" description:"whether the answer is correct" enum:"yes,no,unsure"`
+	Reason   string `json:"reason" description:"the reason for the response"`
+}
+
 type Evaluator interface {
 	Evaluate(question string, answer string, reference string) (string, error)
 }
@@ -95,6 +102,28 @@ func (v *EvaluatorAgent) Evaluate(question string, answer string, reference stri
 	return response, nil
 }
 
+// EvaluateStructured is Evaluate returning a validated Evaluation, the model is asked again
+// when its response does not conform to the schema of Evaluation
+func (v *EvaluatorAgent) EvaluateStructured(ctx context.Context, question string, answer string, reference string) (Evaluation, error) {
+	content := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, v.systemMessage),
+		llms.TextParts(llms.ChatMessageTypeHuman, fmt.Sprintf(v.userMessage, question, answer, reference)),
+	}
+
+	evaluation, err := internalllms.GenerateStructured[Evaluation](ctx, v.chatModel, content,
+		internalllms.WithStructuredCallOptions(
+			llms.WithTemperature(0.00),
+			llms.WithTopK(1),
+			llms.WithSeed(42),
+		),
+	)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("internalllms.GenerateStructured: %w", err)
+	}
+
+	return evaluation, nil
+}
+
 func NewEvaluatorAgent(model llms.Model) *EvaluatorAgent {
 	v := &EvaluatorAgent{
 		chatModel:     model,
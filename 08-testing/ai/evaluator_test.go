@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+func TestEvaluatorAgent_EvaluateStructured(t *testing.T) {
+	outputs := []string{
+		`{"response": "correct", "reason": "it matches the reference"}`,
+		`{"response": "yes", "reason": "it matches the reference"}`,
+	}
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Format string `json:"format"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Format != "json" {
+			t.Errorf("request format is %q, want json: %v", req.Format, err)
+		}
+
+		output, err := json.Marshal(outputs[calls.Add(1)-1])
+		if err != nil {
+			t.Errorf("json.Marshal: %s", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":`+string(output)+`},"done":true}`)
+	}))
+	defer srv.Close()
+
+	llm, err := ollama.New(ollama.WithModel("llama3.2"), ollama.WithServerURL(srv.URL))
+	if err != nil {
+		t.Fatalf("ollama.New: %s", err)
+	}
+
+	evaluation, err := NewEvaluatorAgent(llm).EvaluateStructured(t.Context(),
+		"Is Madrid the capital of Spain?", "Yes, it is Madrid.", "The capital of Spain is Madrid")
+	if err != nil {
+		t.Fatalf("EvaluateStructured: %s", err)
+	}
+
+	if evaluation.Response != "yes" || calls.Load() != 2 {
+		t.Fatalf("evaluation is %+v after %d calls, want yes after 2", evaluation, calls.Load())
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/tmc/langchaingo/vectorstores"
 
 	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	"github.com/nikolayk812/genai-go/internal/tracing"
 )
 
 const (
@@ -33,7 +34,10 @@ func main() {
 
 func run(ctx context.Context) error {
 	httpCli := &http.Client{
-		Transport: internalhttp.NewLoggingRoundTripper(),
+		Transport: internalhttp.NewLoggingRoundTripper(
+			internalhttp.WithTransport(internalhttp.NewTracingRoundTripper(internalhttp.NewRetryRoundTripper(nil))),
+			internalhttp.WithExportFromEnv(),
+		),
 	}
 
 	chatModel, err := buildChatModel(httpCli)
@@ -62,7 +66,13 @@ func straightAnswer(ctx context.Context, chatModel llms.Model) (string, error) {
 	return chatter.Chat(ctx, question)
 }
 
-func raggedAnswer(ctx context.Context, chatModel llms.Model) (string, error) {
+// raggedAnswer is traced as a single span, parent of the similarity search and of the chat
+func raggedAnswer(ctx context.Context, chatModel llms.Model) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "raggedAnswer")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	chatter, err := buildRaggedChat(ctx, chatModel)
 	if err != nil {
 		return "", fmt.Errorf("build ragged chat: %s", err)
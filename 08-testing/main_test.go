@@ -2,22 +2,93 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"github.com/nikolayk812/genai-go/08-testing/ai"
 	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/chewxy/math32"
 	"github.com/tmc/langchaingo/embeddings"
 )
 
-var httpCli = &http.Client{
-	Transport: internalhttp.NewLoggingRoundTripper(),
+var httpCli = newHTTPClient()
+
+// modelDown holds the error which opened the circuit breaker of the model server, if any
+var modelDown atomic.Pointer[string]
+
+// newHTTPClient records or replays the chat model calls when LLM_CASSETTE_MODE is set:
+// run the tests once with LLM_CASSETTE_MODE=record against a running model server,
+// then with LLM_CASSETTE_MODE=replay without it.
+// When LLM_CACHE_DIR is set, the answers to the repeated prompts are cached in that directory.
+// LLM_HAR_FILE and LLM_CURL export the model calls, see internalhttp.WithExportFromEnv.
+// After consecutive failures of the model server, the remaining tests are skipped by requireModel.
+func newHTTPClient() *http.Client {
+	breaker := internalhttp.NewCircuitBreakerRoundTripper(nil,
+		internalhttp.WithFailureThreshold(3),
+		internalhttp.WithOpenTimeout(time.Minute),
+		internalhttp.WithStateChange(func(backend string, from, to internalhttp.CircuitState) {
+			log.Printf("circuit breaker of %s: %s -> %s", backend, from, to)
+
+			switch to {
+			case internalhttp.CircuitOpen:
+				msg := fmt.Sprintf("model server %s is down", backend)
+				modelDown.Store(&msg)
+			case internalhttp.CircuitClosed:
+				modelDown.Store(nil)
+			}
+		}),
+	)
+
+	var transport http.RoundTripper = breaker
+	if cacheDir := os.Getenv("LLM_CACHE_DIR"); cacheDir != "" {
+		transport = internalhttp.NewCacheRoundTripper(internalhttp.NewDiskCacheStore(cacheDir), transport)
+	}
+
+	opts := []internalhttp.LoggingRoundTripperOption{
+		internalhttp.WithTransport(transport),
+		internalhttp.WithExportFromEnv(),
+	}
+
+	if modeEnv := os.Getenv("LLM_CASSETTE_MODE"); modeEnv != "" {
+		mode, err := internalhttp.ParseCassetteMode(modeEnv)
+		if err != nil {
+			log.Fatalf("internalhttp.ParseCassetteMode: %s", err)
+		}
+
+		cassette, err := internalhttp.NewCassette(filepath.Join("testdata", "cassette.json"), mode)
+		if err != nil {
+			log.Fatalf("internalhttp.NewCassette: %s", err)
+		}
+
+		opts = append(opts, internalhttp.WithCassette(cassette))
+	}
+
+	return &http.Client{
+		Transport: internalhttp.NewLoggingRoundTripper(opts...),
+	}
+}
+
+// requireModel skips the test once the circuit breaker of the model server is open,
+// instead of waiting for the timeout of every remaining call
+func requireModel(t *testing.T) {
+	t.Helper()
+
+	if msg := modelDown.Load(); msg != nil {
+		t.Skipf("skipping: %s", *msg)
+	}
 }
 
 func Test1_oldSchool(t *testing.T) {
+	requireModel(t)
+
 	chatModel, err := buildChatModel(httpCli)
 	if err != nil {
 		t.Fatalf("build chat model: %s", err)
@@ -35,6 +106,8 @@ func Test1_oldSchool(t *testing.T) {
 		t.Setenv("VECTOR_STORE", "pgvector")
 
 		t.Run("straight-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := straightAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight chat: %s", err)
@@ -44,6 +117,8 @@ func Test1_oldSchool(t *testing.T) {
 		})
 
 		t.Run("ragged-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := raggedAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight chat: %s", err)
@@ -55,6 +130,8 @@ func Test1_oldSchool(t *testing.T) {
 
 	t.Run("weaviate", func(t *testing.T) {
 		t.Run("straight-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := straightAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight chat: %s", err)
@@ -64,6 +141,8 @@ func Test1_oldSchool(t *testing.T) {
 		})
 
 		t.Run("ragged-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := raggedAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight chat: %s", err)
@@ -75,6 +154,8 @@ func Test1_oldSchool(t *testing.T) {
 }
 
 func Test2_embeddings(t *testing.T) {
+	requireModel(t)
+
 	chatModel, err := buildChatModel(httpCli)
 	if err != nil {
 		t.Fatalf("build chat model: %s", err)
@@ -116,6 +197,8 @@ func Test2_embeddings(t *testing.T) {
 		t.Setenv("VECTOR_STORE", "pgvector")
 
 		t.Run("straight-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := straightAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight answer: %s", err)
@@ -125,6 +208,8 @@ func Test2_embeddings(t *testing.T) {
 		})
 
 		t.Run("ragged-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := raggedAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("ragged answer: %s", err)
@@ -136,6 +221,8 @@ func Test2_embeddings(t *testing.T) {
 
 	t.Run("weaviate", func(t *testing.T) {
 		t.Run("straight-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := straightAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight answer: %s", err)
@@ -145,6 +232,8 @@ func Test2_embeddings(t *testing.T) {
 		})
 
 		t.Run("ragged-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := raggedAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("ragged answer: %s", err)
@@ -176,6 +265,8 @@ func cosineSimilarity(t *testing.T, x, y []float32) float32 {
 }
 
 func Test3_evaluatorAgent(t *testing.T) {
+	requireModel(t)
+
 	reference := `
 There 2 things which answer must contain:
 - Answer must indicate that you can enable verbose logging in Testcontainers Desktop by setting the property cloud.logs.verbose to true in the ~/.testcontainers.properties file
@@ -202,10 +293,13 @@ There 2 things which answer must contain:
 			Reason   string `json:"reason"`
 		}
 
-		var jsonResp r
-		err = json.Unmarshal([]byte(resp), &jsonResp)
+		// llama3.2 sometimes wraps the JSON in a code fence or adds a preface
+		jsonResp, repairs, err := internalllms.DecodeJSON[r](resp)
 		if err != nil {
-			innerT.Fatalf("json unmarshal: %s", err)
+			innerT.Fatalf("decode evaluation: %s\n%s", err, resp)
+		}
+		if len(repairs) > 0 {
+			innerT.Logf("evaluation repaired: %v", repairs)
 		}
 
 		if jsonResp.Response != "yes" {
@@ -217,6 +311,8 @@ There 2 things which answer must contain:
 		t.Setenv("VECTOR_STORE", "pgvector")
 
 		t.Run("straight-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := straightAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight answer: %s", err)
@@ -226,6 +322,8 @@ There 2 things which answer must contain:
 		})
 
 		t.Run("ragged-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := raggedAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("ragged answer: %s", err)
@@ -237,6 +335,8 @@ There 2 things which answer must contain:
 
 	t.Run("weaviate", func(t *testing.T) {
 		t.Run("straight-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := straightAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("straight answer: %s", err)
@@ -246,6 +346,8 @@ There 2 things which answer must contain:
 		})
 
 		t.Run("ragged-answer", func(tt *testing.T) {
+			requireModel(tt)
+
 			answer, err := raggedAnswer(t.Context(), chatModel)
 			if err != nil {
 				tt.Fatalf("ragged answer: %s", err)
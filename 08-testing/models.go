@@ -2,34 +2,55 @@ package main
 
 import (
 	"fmt"
+	internalmodels "github.com/nikolayk812/genai-go/internal/models"
 	"github.com/tmc/langchaingo/embeddings"
 	"github.com/tmc/langchaingo/llms"
 	"net/http"
-
-	"github.com/tmc/langchaingo/llms/ollama"
 )
 
+// loadConfig returns the traced models of the local Ollama,
+// which LLM_CONFIG or the LLM_* environment variables can replace
+func loadConfig() (internalmodels.Config, error) {
+	tracing := true
+
+	chat := internalmodels.Ollama("llama3.2")
+	chat.Tracing = &tracing
+
+	embedding := internalmodels.Ollama("nomic-embed-text:v1.5")
+	embedding.Tracing = &tracing
+	embedding.Transport = []string{}
+
+	cfg, err := internalmodels.Load(internalmodels.Config{Chat: chat, Embedding: embedding})
+	if err != nil {
+		return internalmodels.Config{}, fmt.Errorf("internalmodels.Load: %w", err)
+	}
+
+	return cfg, nil
+}
+
 func buildChatModel(httpCli *http.Client) (llms.Model, error) {
-	llm, err := ollama.New(
-		ollama.WithModel("llama3.2"),
-		ollama.WithServerURL("http://localhost:11434"),
-		ollama.WithHTTPClient(httpCli),
-	)
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loadConfig: %w", err)
+	}
+
+	llm, err := internalmodels.NewModel(cfg.Chat, internalmodels.WithHTTPClient(httpCli))
 	if err != nil {
-		return nil, fmt.Errorf("ollama.New: %w", err)
+		return nil, fmt.Errorf("internalmodels.NewModel: %w", err)
 	}
 
 	return llm, nil
 }
 
 func buildEmbeddingModel() (embeddings.EmbedderClient, error) {
-	llm, err := ollama.New(
-		ollama.WithModel("nomic-embed-text:v1.5"),
-		ollama.WithServerURL("http://localhost:11434"),
-		//ollama.WithHTTPClient(httpCli),
-	)
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loadConfig: %w", err)
+	}
+
+	llm, err := internalmodels.NewEmbedder(cfg.Embedding)
 	if err != nil {
-		return nil, fmt.Errorf("ollama.New: %w", err)
+		return nil, fmt.Errorf("internalmodels.NewEmbedder: %w", err)
 	}
 
 	return llm, nil
@@ -5,6 +5,7 @@ import (
 	"embed"
 	"fmt"
 	"github.com/nikolayk812/genai-go/08-testing/weaviate"
+	"github.com/nikolayk812/genai-go/internal/tracing"
 	"io/fs"
 	"log"
 	"os"
@@ -77,6 +78,10 @@ func selectStore(ctx context.Context, embedder embeddings.Embedder) (vectorstore
 	//case "pgvector":
 	//	return pgvector.NewStore(ctx, embedder)
 	default:
-		return weaviate.NewStore(embedder)
+		store, err := weaviate.NewStore(embedder)
+		if err != nil {
+			return nil, fmt.Errorf("weaviate.NewStore: %w", err)
+		}
+		return tracing.NewVectorStore(store), nil
 	}
 }
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"regexp"
 	"slices"
+	"strings"
 
 	"github.com/tmc/langchaingo/llms"
 
@@ -49,14 +51,38 @@ type Call struct {
 	Input map[string]any `json:"tool_input"`
 }
 
+// callFence matches a Markdown code fence around the calls.
+var callFence = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*(.*?)```")
+
 // unmarshalCall unmarshals the input string into a list of Call objects.
+// The model may wrap the list in a code fence or after a preface, or return a single call object,
+// so every opening bracket is tried until one decodes into a call.
+// This module cannot import the JSON repair of internal/llms, so single quotes or trailing commas still fail.
 func unmarshalCall(input string) []Call {
-	var calls []Call
-	if err := json.Unmarshal([]byte(input), &calls); err != nil {
-		return nil
+	text := input
+	if m := callFence.FindStringSubmatch(text); m != nil {
+		text = m[1]
+	}
+
+	for i := 0; i < len(text); i++ {
+		dec := json.NewDecoder(strings.NewReader(text[i:]))
+
+		switch text[i] {
+		case '[':
+			var calls []Call
+			if err := dec.Decode(&calls); err == nil && len(calls) > 0 && calls[0].Tool != "" {
+				return calls
+			}
+		case '{':
+			var call Call
+			if err := dec.Decode(&call); err == nil && call.Tool != "" {
+				return []Call{call}
+			}
+		}
 	}
 
-	return calls
+	log.Printf("unmarshal call: no tool call in %q", input)
+	return nil
 }
 
 // dispatchCall dispatches a call to the appropriate tool.
@@ -0,0 +1,244 @@
+// Package chat holds the conversation state shared by the chat examples
+package chat
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Strategy decides which messages of a conversation are sent to the model.
+// The system messages at the start of the conversation are never passed to it.
+type Strategy interface {
+	Trim(ctx context.Context, system, messages []llms.MessageContent) ([]llms.MessageContent, Report, error)
+}
+
+// Report tells what a strategy did to the messages
+type Report struct {
+	Dropped    int
+	Summarized int
+	// Summary is the new summary message, when messages were summarized
+	Summary string
+}
+
+// IsZero reports whether the messages were left as they were
+func (r Report) IsZero() bool {
+	return r.Dropped == 0 && r.Summarized == 0
+}
+
+func (r Report) String() string {
+	var parts []string
+	if r.Summarized > 0 {
+		parts = append(parts, fmt.Sprintf("summarized %d earlier messages", r.Summarized))
+	}
+	if r.Dropped > 0 {
+		parts = append(parts, fmt.Sprintf("dropped %d earlier messages", r.Dropped))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Memory holds the messages of a conversation and trims them with its strategy
+type Memory struct {
+	strategy Strategy
+	system   []llms.MessageContent
+	messages []llms.MessageContent
+}
+
+// NewMemory creates a memory, a nil strategy keeps all the messages
+func NewMemory(strategy Strategy) *Memory {
+	return &Memory{strategy: strategy}
+}
+
+// SetSystem replaces the system prompt, which is always sent first
+func (m *Memory) SetSystem(prompt string) {
+	m.system = nil
+	if prompt != "" {
+		m.system = []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, prompt)}
+	}
+}
+
+// Add appends the messages, a system message is appended as is and can be trimmed
+func (m *Memory) Add(messages ...llms.MessageContent) {
+	m.messages = append(m.messages, messages...)
+}
+
+// Messages returns the system prompt followed by the kept messages
+func (m *Memory) Messages() []llms.MessageContent {
+	messages := make([]llms.MessageContent, 0, len(m.system)+len(m.messages))
+	messages = append(messages, m.system...)
+	return append(messages, m.messages...)
+}
+
+// Len returns the number of messages without the system prompt
+func (m *Memory) Len() int {
+	return len(m.messages)
+}
+
+// Reset forgets the messages and keeps the system prompt
+func (m *Memory) Reset() {
+	m.messages = nil
+}
+
+// SetStrategy replaces the strategy, e.g. for a model with another context window
+func (m *Memory) SetStrategy(strategy Strategy) {
+	m.strategy = strategy
+}
+
+// Undo drops the last human message and the answers which follow it,
+// it reports false when no human message is left to drop
+func (m *Memory) Undo() bool {
+	for i, message := range slices.Backward(m.messages) {
+		if message.Role == llms.ChatMessageTypeHuman {
+			m.messages = m.messages[:i]
+			return true
+		}
+	}
+	return false
+}
+
+// Trim applies the strategy, to be called before sending the messages to the model
+func (m *Memory) Trim(ctx context.Context) (Report, error) {
+	if m.strategy == nil || len(m.messages) == 0 {
+		return Report{}, nil
+	}
+
+	messages, report, err := m.strategy.Trim(ctx, m.system, m.messages)
+	if err != nil {
+		return Report{}, fmt.Errorf("strategy.Trim: %w", err)
+	}
+
+	m.messages = messages
+	return report, nil
+}
+
+// SlidingWindow keeps the last n messages
+type SlidingWindow struct {
+	Messages int
+}
+
+func (s SlidingWindow) Trim(ctx context.Context, system, messages []llms.MessageContent) ([]llms.MessageContent, Report, error) {
+	cut := startOfTurn(messages, max(len(messages)-s.Messages, 0))
+	return messages[cut:], Report{Dropped: cut}, nil
+}
+
+// TokenBudget drops the oldest messages until the conversation fits into MaxTokens, as estimated by Counter,
+// e.g. the context window less the room for the completion. The last message is always kept.
+type TokenBudget struct {
+	Counter   *internalllms.TokenCounter
+	MaxTokens int
+}
+
+func (s TokenBudget) Trim(ctx context.Context, system, messages []llms.MessageContent) ([]llms.MessageContent, Report, error) {
+	cut := fitBudget(s.Counter, s.MaxTokens, system, messages)
+	return messages[cut:], Report{Dropped: cut}, nil
+}
+
+// fitBudget returns how many of the oldest messages to drop to fit into maxTokens
+func fitBudget(counter *internalllms.TokenCounter, maxTokens int, system, messages []llms.MessageContent) int {
+	cut := 0
+	for cut < len(messages)-1 && counter.CountMessages(append(system[:len(system):len(system)], messages[cut:]...)) > maxTokens {
+		cut++
+	}
+	return startOfTurn(messages, cut)
+}
+
+// startOfTurn moves the cut forward to a human message, so the kept messages do not start with an answer
+func startOfTurn(messages []llms.MessageContent, cut int) int {
+	if cut == 0 {
+		return 0
+	}
+	for cut < len(messages)-1 && messages[cut].Role != llms.ChatMessageTypeHuman {
+		cut++
+	}
+	return cut
+}
+
+// Summarize condenses the older messages into a summary message once the conversation exceeds MaxTokens,
+// keeping the last KeepMessages as they are. The summary is a system message, which is condensed again
+// together with the next older messages, so it rolls along the conversation. When the kept messages
+// alone exceed MaxTokens, the oldest of them are dropped.
+type Summarize struct {
+	Model        llms.Model
+	Counter      *internalllms.TokenCounter
+	MaxTokens    int
+	KeepMessages int
+	// Prompt asks for the summary of the transcript which follows it
+	Prompt string
+}
+
+const defaultSummaryPrompt = "Summarize the conversation below in a few sentences. " +
+	"Keep the facts, names and decisions needed to continue it, and do not add anything else."
+
+const summaryPrefix = "Summary of the earlier conversation: "
+
+func (s Summarize) Trim(ctx context.Context, system, messages []llms.MessageContent) ([]llms.MessageContent, Report, error) {
+	if s.Counter.CountMessages(append(system[:len(system):len(system)], messages...)) <= s.MaxTokens {
+		return messages, Report{}, nil
+	}
+
+	cut := startOfTurn(messages, max(len(messages)-s.KeepMessages, 0))
+	if cut < 2 {
+		// too little to summarize
+		return TokenBudget{Counter: s.Counter, MaxTokens: s.MaxTokens}.Trim(ctx, system, messages)
+	}
+
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = defaultSummaryPrompt
+	}
+
+	resp, err := s.Model.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt+"\n\n"+transcript(messages[:cut])),
+	})
+	if err != nil {
+		return nil, Report{}, fmt.Errorf("model.GenerateContent: %w", err)
+	}
+
+	summary := strings.TrimSpace(strings.Join(internalllms.ContentResponseToStrings(resp), ""))
+
+	kept := append([]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, summaryPrefix+summary)}, messages[cut:]...)
+	report := Report{Summarized: cut, Summary: summary}
+
+	// the summary is sent after the system prompt, so the kept messages get what is left of the budget
+	if dropped := fitBudget(s.Counter, s.MaxTokens, append(slices.Clone(system), kept[0]), kept[1:]); dropped > 0 {
+		kept = append(kept[:1], kept[1+dropped:]...)
+		report.Dropped = dropped
+	}
+
+	return kept, report, nil
+}
+
+// transcript renders the messages as "Role: text" lines for the summary prompt
+func transcript(messages []llms.MessageContent) string {
+	var sb strings.Builder
+	for _, message := range messages {
+		text := messageText(message)
+		if text == "" {
+			continue
+		}
+
+		role := "User"
+		switch message.Role {
+		case llms.ChatMessageTypeAI:
+			role = "Assistant"
+		case llms.ChatMessageTypeSystem:
+			role = "Context"
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", role, text)
+	}
+	return sb.String()
+}
+
+func messageText(message llms.MessageContent) string {
+	var sb strings.Builder
+	for _, part := range message.Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
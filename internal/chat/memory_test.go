@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nikolayk812/genai-go/internal/fake"
+	"github.com/nikolayk812/genai-go/internal/fake/faketest"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// turns returns n exchanges of a human question and an AI answer of 10 words each
+func turns(n int) []llms.MessageContent {
+	var messages []llms.MessageContent
+	for i := range n {
+		messages = append(messages,
+			llms.TextParts(llms.ChatMessageTypeHuman, fmt.Sprintf("question %d", i)+strings.Repeat(" word", 8)),
+			llms.TextParts(llms.ChatMessageTypeAI, fmt.Sprintf("answer %d", i)+strings.Repeat(" word", 8)),
+		)
+	}
+	return messages
+}
+
+// wordCounter counts one token per word and no template overhead
+func wordCounter() *internalllms.TokenCounter {
+	return internalllms.NewTokenCounter("llama3.2",
+		internalllms.WithTokenizer(wordTokenizer{}), internalllms.WithMessageOverhead(0))
+}
+
+type wordTokenizer struct{}
+
+func (wordTokenizer) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestSlidingWindow(t *testing.T) {
+	memory := NewMemory(SlidingWindow{Messages: 3})
+	memory.SetSystem("You are a fellow Go developer.")
+	memory.Add(turns(3)...)
+
+	report, err := memory.Trim(t.Context())
+	if err != nil {
+		t.Fatalf("Trim: %s", err)
+	}
+
+	// the window starts at the question of the last turn, not at an answer
+	messages := memory.Messages()
+	if report.Dropped != 4 || len(messages) != 3 || messages[1].Role != llms.ChatMessageTypeHuman {
+		t.Fatalf("unexpected trim: %s, %d messages", report, len(messages))
+	}
+}
+
+func TestTokenBudget(t *testing.T) {
+	memory := NewMemory(TokenBudget{Counter: wordCounter(), MaxTokens: 50})
+	memory.SetSystem("You are a fellow Go developer.")
+	memory.Add(turns(3)...)
+
+	report, err := memory.Trim(t.Context())
+	if err != nil {
+		t.Fatalf("Trim: %s", err)
+	}
+
+	// 6 system words + 2 turns of 20 words fit into 50 tokens
+	messages := memory.Messages()
+	if report.Dropped != 2 || len(messages) != 5 || messages[0].Role != llms.ChatMessageTypeSystem {
+		t.Fatalf("unexpected trim: %s, %d messages", report, len(messages))
+	}
+
+	if report, _ := memory.Trim(t.Context()); !report.IsZero() {
+		t.Fatalf("fitting conversation is trimmed: %s", report)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	model := fake.NewModel().OnMatch(`^Summarize`, fake.Text("The user asked questions 0 to 3."))
+
+	memory := NewMemory(Summarize{Model: model, Counter: wordCounter(), MaxTokens: 60, KeepMessages: 2})
+	memory.Add(turns(4)...)
+
+	report, err := memory.Trim(t.Context())
+	if err != nil {
+		t.Fatalf("Trim: %s", err)
+	}
+
+	messages := memory.Messages()
+	if report.Summarized != 6 || len(messages) != 3 {
+		t.Fatalf("unexpected trim: %s, %d messages", report, len(messages))
+	}
+	if messages[0].Role != llms.ChatMessageTypeSystem || !strings.Contains(messageText(messages[0]), "questions 0 to 3") {
+		t.Fatalf("unexpected summary message: %+v", messages[0])
+	}
+
+	faketest.RequireCalls(t, model, 1)
+	faketest.RequireMessage(t, model, llms.ChatMessageTypeHuman, "Assistant: answer 2")
+}
+
+func TestMemory_Undo(t *testing.T) {
+	memory := NewMemory(nil)
+	memory.SetSystem("You are a helpful assistant.")
+	memory.Add(turns(2)...)
+
+	if !memory.Undo() || memory.Len() != 2 {
+		t.Fatalf("Undo left %d messages, want 2", memory.Len())
+	}
+	if !memory.Undo() || memory.Len() != 0 {
+		t.Fatalf("Undo left %d messages, want 0", memory.Len())
+	}
+	if memory.Undo() {
+		t.Fatalf("Undo of an empty memory reports true")
+	}
+	if messages := memory.Messages(); len(messages) != 1 || messages[0].Role != llms.ChatMessageTypeSystem {
+		t.Fatalf("system prompt is not kept: %+v", messages)
+	}
+}
+
+func TestSummarize_longSummary(t *testing.T) {
+	// 5 words of the prefix and 30 of the summary leave room for one exchange of 20 words in 60 tokens
+	model := fake.NewModel().OnMatch(`^Summarize`, fake.Text(strings.Repeat("summary ", 30)))
+
+	memory := NewMemory(Summarize{Model: model, Counter: wordCounter(), MaxTokens: 60, KeepMessages: 4})
+	memory.Add(turns(4)...)
+
+	report, err := memory.Trim(t.Context())
+	if err != nil {
+		t.Fatalf("Trim: %s", err)
+	}
+
+	messages := memory.Messages()
+	if report.Summarized != 4 || report.Dropped != 2 || len(messages) != 3 {
+		t.Fatalf("unexpected trim: %s, %d messages", report, len(messages))
+	}
+	if tokens := wordCounter().CountMessages(messages); tokens > 60 {
+		t.Fatalf("trimmed conversation has %d tokens, want at most 60", tokens)
+	}
+}
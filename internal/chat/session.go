@@ -0,0 +1,339 @@
+package chat
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrSessionNotFound is returned for a session ID missing from the store
+var ErrSessionNotFound = errors.New("session not found")
+
+// Turn is a message of a session
+type Turn struct {
+	Role llms.ChatMessageType `json:"role"`
+	Text string               `json:"text"`
+	Time time.Time            `json:"time"`
+	// Model and Usage are set for the answers of the model
+	Model string              `json:"model,omitempty"`
+	Usage *internalllms.Usage `json:"usage,omitempty"`
+	// Interrupted marks a partial answer, cancelled by the user
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// Session is a conversation persisted by a Store, with all its turns, whatever the memory sends to the model
+type Session struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	System    string    `json:"system,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Turns     []Turn    `json:"turns"`
+}
+
+// NewSession creates an empty session with a new ID, sortable by creation time
+func NewSession(title string) *Session {
+	now := time.Now().UTC()
+
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+
+	return &Session{
+		ID:        now.Format("20060102-150405-") + hex.EncodeToString(suffix),
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// AddUser appends a message of the user, the first one titles an untitled session
+func (s *Session) AddUser(text string) {
+	if s.Title == "" {
+		s.Title = title(text)
+	}
+	s.add(Turn{Role: llms.ChatMessageTypeHuman, Text: text})
+}
+
+// AddModel appends an answer of the model with its usage, a zero usage is not stored
+func (s *Session) AddModel(text, model string, usage internalllms.Usage) {
+	turn := Turn{Role: llms.ChatMessageTypeAI, Text: text, Model: model}
+	if !usage.IsZero() {
+		turn.Usage = &usage
+	}
+	s.add(turn)
+}
+
+// Undo drops the last message of the user and the answers which follow it, returning its text,
+// e.g. to ask it again. It reports false when the session has no message of the user.
+func (s *Session) Undo() (string, bool) {
+	for i, turn := range slices.Backward(s.Turns) {
+		if turn.Role == llms.ChatMessageTypeHuman {
+			s.Turns = s.Turns[:i]
+			s.UpdatedAt = time.Now().UTC()
+			return turn.Text, true
+		}
+	}
+	return "", false
+}
+
+// AddInterrupted appends the partial answer of a cancelled generation
+func (s *Session) AddInterrupted(text, model string) {
+	s.add(Turn{Role: llms.ChatMessageTypeAI, Text: text, Model: model, Interrupted: true})
+}
+
+func (s *Session) add(turn Turn) {
+	turn.Time = time.Now().UTC()
+	s.Turns = append(s.Turns, turn)
+	s.UpdatedAt = turn.Time
+}
+
+// Messages returns the turns as the messages of a conversation, e.g. to resume it into a Memory,
+// the system prompt is not among them
+func (s *Session) Messages() []llms.MessageContent {
+	messages := make([]llms.MessageContent, 0, len(s.Turns))
+	for _, turn := range s.Turns {
+		messages = append(messages, llms.TextParts(turn.Role, turn.Text))
+	}
+	return messages
+}
+
+// Usage returns the total usage of the session
+func (s *Session) Usage() internalllms.Usage {
+	var total internalllms.Usage
+	for _, turn := range s.Turns {
+		if turn.Usage != nil {
+			total = total.Add(*turn.Usage)
+		}
+	}
+	return total
+}
+
+func title(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > 50 {
+		return string(runes[:50]) + "…"
+	}
+	return text
+}
+
+// WriteMarkdown writes the transcript of the session as Markdown
+func (s *Session) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# %s\n\n", s.Title)
+	fmt.Fprintf(&sb, "Session `%s`, started %s.\n", s.ID, s.CreatedAt.Format(time.RFC3339))
+
+	for _, turn := range s.Turns {
+		switch turn.Role {
+		case llms.ChatMessageTypeHuman:
+			fmt.Fprintf(&sb, "\n## You, %s\n\n", turn.Time.Format(time.RFC3339))
+		case llms.ChatMessageTypeAI:
+			fmt.Fprintf(&sb, "\n## %s, %s\n\n", cmp.Or(turn.Model, "Model"), turn.Time.Format(time.RFC3339))
+		default:
+			fmt.Fprintf(&sb, "\n## %s, %s\n\n", turn.Role, turn.Time.Format(time.RFC3339))
+		}
+
+		sb.WriteString(turn.Text)
+		sb.WriteString("\n")
+
+		if turn.Interrupted {
+			sb.WriteString("\n_interrupted_\n")
+		}
+
+		if turn.Usage != nil {
+			fmt.Fprintf(&sb, "\n_%d prompt and %d completion tokens_\n", turn.Usage.PromptTokens, turn.Usage.CompletionTokens)
+		}
+	}
+
+	if usage := s.Usage(); !usage.IsZero() {
+		fmt.Fprintf(&sb, "\n---\n\nTotal: %d prompt and %d completion tokens.\n", usage.PromptTokens, usage.CompletionTokens)
+	}
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("io.WriteString: %w", err)
+	}
+
+	return nil
+}
+
+// WriteJSONL writes the turns of the session as JSON lines, each with the session ID
+func (s *Session) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	for _, turn := range s.Turns {
+		line := struct {
+			Session string `json:"session"`
+			Turn
+		}{Session: s.ID, Turn: turn}
+
+		if err := enc.Encode(line); err != nil {
+			return fmt.Errorf("enc.Encode: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// SessionInfo describes a stored session without its turns
+type SessionInfo struct {
+	ID        string
+	Title     string
+	Turns     int
+	UpdatedAt time.Time
+}
+
+// Store persists the sessions as JSON files in a directory, one file per session
+type Store struct {
+	dir string
+}
+
+// DefaultStoreDir is the sessions directory in the user configuration directory
+func DefaultStoreDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserConfigDir: %w", err)
+	}
+	return filepath.Join(dir, "genai-go", "sessions"), nil
+}
+
+// NewStore creates the directory if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+var sessionID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (s *Store) path(id string) (string, error) {
+	if !sessionID.MatchString(id) {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Save writes the session, replacing its previous version atomically
+func (s *Store) Save(session *Session) error {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, session.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("tmp.Write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("tmp.Close: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads a session, it returns ErrSessionNotFound when it is not stored
+func (s *Store) Load(id string) (*Session, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal %s: %w", id, err)
+	}
+
+	return &session, nil
+}
+
+// List returns the stored sessions, the most recently updated first
+func (s *Store) List() ([]SessionInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Glob: %w", err)
+	}
+
+	infos := make([]SessionInfo, 0, len(paths))
+	for _, path := range paths {
+		session, err := s.Load(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, SessionInfo{
+			ID:        session.ID,
+			Title:     session.Title,
+			Turns:     len(session.Turns),
+			UpdatedAt: session.UpdatedAt,
+		})
+	}
+
+	slices.SortFunc(infos, func(a, b SessionInfo) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	return infos, nil
+}
+
+// Rename changes the title of a stored session
+func (s *Store) Rename(id, title string) error {
+	session, err := s.Load(id)
+	if err != nil {
+		return err
+	}
+
+	session.Title = title
+	return s.Save(session)
+}
+
+// Delete removes a stored session, it returns ErrSessionNotFound when it is not stored
+func (s *Store) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	} else if err != nil {
+		return fmt.Errorf("os.Remove: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %s", err)
+	}
+
+	session := NewSession("")
+	session.AddUser("What is the capital of Japan?")
+	session.AddModel("Tokyo.", "llama3.2", internalllms.Usage{PromptTokens: 30, CompletionTokens: 3, TotalTokens: 33})
+
+	if err := store.Save(session); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	if err := store.Rename(session.ID, "Capitals"); err != nil {
+		t.Fatalf("Rename: %s", err)
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(infos) != 1 || infos[0].Title != "Capitals" || infos[0].Turns != 2 {
+		t.Fatalf("unexpected sessions: %+v", infos)
+	}
+
+	resumed, err := store.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	messages := resumed.Messages()
+	if len(messages) != 2 || messages[1].Role != llms.ChatMessageTypeAI || resumed.Usage().TotalTokens != 33 {
+		t.Fatalf("unexpected resumed session: %+v", resumed)
+	}
+
+	if err := store.Delete(session.ID); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if _, err := store.Load(session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("error is %v, want ErrSessionNotFound", err)
+	}
+	if _, err := store.Load("../secrets"); err == nil {
+		t.Fatalf("path traversal is accepted")
+	}
+}
+
+func TestSession_export(t *testing.T) {
+	session := NewSession("")
+	session.AddUser("What is the capital of Japan?")
+	session.AddModel("Tokyo.", "llama3.2", internalllms.Usage{PromptTokens: 30, CompletionTokens: 3, TotalTokens: 33})
+	session.AddUser("Tell me about its history.")
+	session.AddInterrupted("Tokyo was", "llama3.2")
+
+	var md strings.Builder
+	if err := session.WriteMarkdown(&md); err != nil {
+		t.Fatalf("WriteMarkdown: %s", err)
+	}
+	for _, want := range []string{"# What is the capital of Japan?", "## llama3.2, ", "_30 prompt and 3 completion tokens_", "Tokyo was\n\n_interrupted_"} {
+		if !strings.Contains(md.String(), want) {
+			t.Fatalf("markdown has no %q:\n%s", want, md.String())
+		}
+	}
+
+	var jsonl strings.Builder
+	if err := session.WriteJSONL(&jsonl); err != nil {
+		t.Fatalf("WriteJSONL: %s", err)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(strings.NewReader(jsonl.String()))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("json.Unmarshal: %s", err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 4 || lines[1]["session"] != session.ID || lines[1]["model"] != "llama3.2" || lines[1]["usage"] == nil || lines[3]["interrupted"] != true {
+		t.Fatalf("unexpected JSON lines:\n%s", jsonl.String())
+	}
+}
+
+func TestSession_Undo(t *testing.T) {
+	session := NewSession("")
+	session.AddUser("What is the capital of Japan?")
+	session.AddModel("Tokyo.", "llama3.2", internalllms.Usage{})
+	session.AddUser("And of France?")
+
+	if text, ok := session.Undo(); !ok || text != "And of France?" || len(session.Turns) != 2 {
+		t.Fatalf("Undo returned %q, %t with %d turns left", text, ok, len(session.Turns))
+	}
+	if text, ok := session.Undo(); !ok || text != "What is the capital of Japan?" || len(session.Turns) != 0 {
+		t.Fatalf("Undo returned %q, %t with %d turns left", text, ok, len(session.Turns))
+	}
+	if _, ok := session.Undo(); ok {
+		t.Fatalf("Undo of an empty session reports true")
+	}
+}
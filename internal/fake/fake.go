@@ -0,0 +1,383 @@
+// Package fake provides a deterministic llms.Model and embeddings.EmbedderClient for the tests
+// which must run without a model server. The assertions on its calls are in package faketest,
+// so the binaries registering the fake provider do not link package testing.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ErrUnexpectedPrompt is returned for a prompt which no script answers, unless WithEcho is set
+var ErrUnexpectedPrompt = errors.New("fake: unexpected prompt")
+
+// Response is a scripted answer of the model
+type Response struct {
+	Text      string
+	ToolCalls []llms.ToolCall
+	// StopReason defaults to "tool_calls" for a response with tool calls, or else "stop"
+	StopReason string
+	// Err is returned instead of a response, after streaming the text if any
+	Err error
+}
+
+// Text returns a response with the text
+func Text(text string) Response {
+	return Response{Text: text}
+}
+
+// Error returns a response failing with err
+func Error(err error) Response {
+	return Response{Err: err}
+}
+
+// ToolCalls returns a response asking to call the tools
+func ToolCalls(calls ...llms.ToolCall) Response {
+	return Response{ToolCalls: calls}
+}
+
+// ToolCall returns a function call with the arguments marshaled to JSON, a string is used as is
+func ToolCall(id, name string, arguments any) llms.ToolCall {
+	args, ok := arguments.(string)
+	if !ok {
+		data, err := json.Marshal(arguments)
+		if err != nil {
+			panic(fmt.Sprintf("fake: json.Marshal: %s", err))
+		}
+		args = string(data)
+	}
+
+	return llms.ToolCall{ID: id, Type: "function", FunctionCall: &llms.FunctionCall{Name: name, Arguments: args}}
+}
+
+// Call is a GenerateContent call received by the model
+type Call struct {
+	Messages []llms.MessageContent
+	Options  llms.CallOptions
+	// Prompt is the text of the last human message, which the scripts are matched against
+	Prompt string
+}
+
+// script answers the prompts it matches, with its responses in order, repeating the last one
+type script struct {
+	match     func(prompt string) bool
+	responses []Response
+	used      int
+}
+
+func (s *script) next() Response {
+	r := s.responses[min(s.used, len(s.responses)-1)]
+	s.used++
+	return r
+}
+
+// Model is a fake llms.Model and embeddings.EmbedderClient, safe for concurrent use.
+// A prompt is answered by the first matching OnPrompt or OnMatch script, or else by the next
+// response of the Enqueue sequence.
+type Model struct {
+	chunkSize  int
+	chunkDelay time.Duration
+	dimension  int
+	echo       bool
+
+	mu       sync.Mutex
+	scripts  []*script
+	sequence []Response
+	calls    []Call
+	embedded []string
+}
+
+var (
+	_ llms.Model                = (*Model)(nil)
+	_ embeddings.EmbedderClient = (*Model)(nil)
+)
+
+// Option is a functional option for Model
+type Option func(*Model)
+
+// WithChunkSize sets the runes per streamed chunk, 4 by default
+func WithChunkSize(runes int) Option {
+	return func(m *Model) {
+		m.chunkSize = runes
+	}
+}
+
+// WithChunkDelay sleeps before every streamed chunk, to test the timeouts and the progress output
+func WithChunkDelay(d time.Duration) Option {
+	return func(m *Model) {
+		m.chunkDelay = d
+	}
+}
+
+// WithDimension sets the dimension of the embeddings, 384 by default
+func WithDimension(n int) Option {
+	return func(m *Model) {
+		m.dimension = n
+	}
+}
+
+// WithEcho answers the unscripted prompts with the prompt itself instead of ErrUnexpectedPrompt
+func WithEcho() Option {
+	return func(m *Model) {
+		m.echo = true
+	}
+}
+
+func NewModel(opts ...Option) *Model {
+	m := &Model{chunkSize: 4, dimension: 384}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// OnPrompt answers the exact prompt with the responses
+func (m *Model) OnPrompt(prompt string, responses ...Response) *Model {
+	return m.on(func(p string) bool { return p == prompt }, responses)
+}
+
+// OnMatch answers the prompts matching the regular expression with the responses
+func (m *Model) OnMatch(pattern string, responses ...Response) *Model {
+	re := regexp.MustCompile(pattern)
+	return m.on(re.MatchString, responses)
+}
+
+func (m *Model) on(match func(string) bool, responses []Response) *Model {
+	if len(responses) == 0 {
+		panic("fake: a script needs at least one response")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scripts = append(m.scripts, &script{match: match, responses: responses})
+	return m
+}
+
+// Enqueue appends the responses to the sequence answering the prompts no script matches
+func (m *Model) Enqueue(responses ...Response) *Model {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sequence = append(m.sequence, responses...)
+	return m
+}
+
+func (m *Model) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	opts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	call := Call{Messages: messages, Options: opts, Prompt: lastHumanText(messages)}
+
+	resp, err := m.respond(call)
+	if err != nil {
+		return nil, err
+	}
+
+	text, stopReason := resp.Text, resp.StopReason
+	if opts.MaxTokens > 0 {
+		if truncated, ok := truncateWords(text, opts.MaxTokens); ok {
+			text, stopReason = truncated, "length"
+		}
+	}
+
+	if opts.StreamingFunc != nil {
+		if err := m.stream(ctx, text, opts.StreamingFunc); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+
+	if stopReason == "" {
+		stopReason = "stop"
+		if len(resp.ToolCalls) > 0 {
+			stopReason = "tool_calls"
+		}
+	}
+
+	choice := &llms.ContentChoice{
+		Content:    text,
+		StopReason: stopReason,
+		ToolCalls:  resp.ToolCalls,
+		GenerationInfo: map[string]any{
+			"PromptTokens":     countTokens(messages),
+			"CompletionTokens": len(strings.Fields(text)),
+			"TotalTokens":      countTokens(messages) + len(strings.Fields(text)),
+		},
+	}
+	if len(resp.ToolCalls) > 0 {
+		choice.FuncCall = resp.ToolCalls[0].FunctionCall
+	}
+
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{choice}}, nil
+}
+
+func (m *Model) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func (m *Model) respond(call Call) (Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, call)
+
+	for _, s := range m.scripts {
+		if s.match(call.Prompt) {
+			return s.next(), nil
+		}
+	}
+
+	if len(m.sequence) > 0 {
+		r := m.sequence[0]
+		m.sequence = m.sequence[1:]
+		return r, nil
+	}
+
+	if m.echo {
+		return Text(call.Prompt), nil
+	}
+
+	return Response{}, fmt.Errorf("%w: %q", ErrUnexpectedPrompt, call.Prompt)
+}
+
+// stream sends the text in chunks of chunkSize runes, it stops at the first error of the func
+func (m *Model) stream(ctx context.Context, text string, f func(ctx context.Context, chunk []byte) error) error {
+	for text != "" {
+		if m.chunkDelay > 0 {
+			select {
+			case <-time.After(m.chunkDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		n := 0
+		for i := 0; i < max(m.chunkSize, 1) && n < len(text); i++ {
+			_, size := utf8.DecodeRuneInString(text[n:])
+			n += size
+		}
+
+		if err := f(ctx, []byte(text[:n])); err != nil {
+			return err
+		}
+		text = text[n:]
+	}
+
+	return nil
+}
+
+// CreateEmbedding returns deterministic unit vectors hashed from the words of the texts,
+// so the texts sharing words are similar, e.g. for the retrieval tests
+func (m *Model) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	m.mu.Lock()
+	m.embedded = append(m.embedded, texts...)
+	m.mu.Unlock()
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = embed(text, m.dimension)
+	}
+
+	return vectors, nil
+}
+
+// Calls returns the GenerateContent calls received so far
+func (m *Model) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Call(nil), m.calls...)
+}
+
+// Embedded returns the texts embedded so far
+func (m *Model) Embedded() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.embedded...)
+}
+
+// Unused returns the indexes of the scripts which were never used and the number of enqueued responses left
+func (m *Model) Unused() (scripts []int, responses int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.scripts {
+		if s.used == 0 {
+			scripts = append(scripts, i)
+		}
+	}
+
+	return scripts, len(m.sequence)
+}
+
+func lastHumanText(messages []llms.MessageContent) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == llms.ChatMessageTypeHuman || messages[i].Role == llms.ChatMessageTypeGeneric {
+			return messageText(messages[i])
+		}
+	}
+	return ""
+}
+
+func messageText(message llms.MessageContent) string {
+	var sb strings.Builder
+	for _, part := range message.Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
+
+// countTokens counts the words of the messages as tokens, so the usage is deterministic
+func countTokens(messages []llms.MessageContent) int {
+	var n int
+	for _, message := range messages {
+		n += len(strings.Fields(messageText(message)))
+	}
+	return n
+}
+
+// truncateWords cuts the text after n words, reporting whether anything was cut
+func truncateWords(text string, n int) (string, bool) {
+	words := 0
+	inWord := false
+
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			inWord = false
+			continue
+		}
+		if !inWord {
+			if words == n {
+				return text[:i], true
+			}
+			words++
+			inWord = true
+		}
+	}
+
+	return text, false
+}
@@ -0,0 +1,133 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestModel_scripts(t *testing.T) {
+	model := NewModel().
+		OnPrompt("Hello", Text("Hi!")).
+		OnMatch(`(?i)weather in \w+`, ToolCalls(ToolCall("call_1", "getWeather", map[string]string{"city": "Madrid"}))).
+		Enqueue(Text("first"), Text("second"))
+
+	answer, err := model.Call(t.Context(), "Hello")
+	if err != nil || answer != "Hi!" {
+		t.Fatalf("answer is %q, %v, want Hi!", answer, err)
+	}
+
+	resp, err := model.GenerateContent(t.Context(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You are a weather bot."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "What is the weather in Madrid?"),
+	})
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+	choice := resp.Choices[0]
+	if choice.StopReason != "tool_calls" || choice.ToolCalls[0].FunctionCall.Arguments != `{"city":"Madrid"}` {
+		t.Fatalf("unexpected choice: %+v", choice)
+	}
+
+	for _, want := range []string{"first", "second"} {
+		if answer, err := model.Call(t.Context(), "Anything"); err != nil || answer != want {
+			t.Fatalf("answer is %q, %v, want %q", answer, err, want)
+		}
+	}
+
+	if _, err := model.Call(t.Context(), "Anything"); !errors.Is(err, ErrUnexpectedPrompt) {
+		t.Fatalf("error is %v, want ErrUnexpectedPrompt", err)
+	}
+
+	calls := model.Calls()
+	if len(calls) != 5 || calls[1].Prompt != "What is the weather in Madrid?" {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+	if scripts, responses := model.Unused(); len(scripts) > 0 || responses > 0 {
+		t.Fatalf("unused scripts %v and %d responses", scripts, responses)
+	}
+}
+
+func TestModel_streaming(t *testing.T) {
+	model := NewModel(WithChunkSize(3), WithEcho())
+
+	var chunks []string
+	resp, err := model.GenerateContent(t.Context(),
+		[]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "¡Hola, Go!")},
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			chunks = append(chunks, string(chunk))
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+
+	if got := strings.Join(chunks, "|"); got != "¡Ho|la,| Go|!" {
+		t.Fatalf("chunks are %q", got)
+	}
+	if resp.Choices[0].Content != "¡Hola, Go!" {
+		t.Fatalf("content is %q", resp.Choices[0].Content)
+	}
+
+	slow := NewModel(WithChunkDelay(time.Second)).Enqueue(Text("too slow"))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = slow.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Hello")},
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error { return nil }))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error is %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestModel_maxTokens(t *testing.T) {
+	model := NewModel().Enqueue(Text("Go is simple, fast and fun."))
+
+	resp, err := model.GenerateContent(t.Context(),
+		[]llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Why Go?")}, llms.WithMaxTokens(3))
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+
+	if choice := resp.Choices[0]; choice.Content != "Go is simple, " || choice.StopReason != "length" {
+		t.Fatalf("unexpected choice: %+v", choice)
+	}
+}
+
+func TestModel_CreateEmbedding(t *testing.T) {
+	model := NewModel(WithDimension(64))
+
+	vectors, err := model.CreateEmbedding(t.Context(), []string{
+		"A cat is a small mammal",
+		"A cat is a small domesticated mammal",
+		"Docker runs containers",
+		"A cat is a small mammal",
+	})
+	if err != nil {
+		t.Fatalf("CreateEmbedding: %s", err)
+	}
+
+	if len(vectors[0]) != 64 || math.Abs(dot(vectors[0], vectors[0])-1) > 1e-6 {
+		t.Fatalf("vector is not a unit vector of 64 dimensions: %v", vectors[0])
+	}
+	if dot(vectors[0], vectors[3]) < 1-1e-6 {
+		t.Fatalf("the same text has different embeddings")
+	}
+	if dot(vectors[0], vectors[1]) <= dot(vectors[0], vectors[2]) {
+		t.Fatalf("related texts are less similar than unrelated ones")
+	}
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i] * b[i])
+	}
+	return sum
+}
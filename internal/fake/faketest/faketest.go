@@ -0,0 +1,80 @@
+// Package faketest provides the test assertions on the calls received by a fake.Model
+package faketest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nikolayk812/genai-go/internal/fake"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// LastCall returns the last GenerateContent call of the model, it fails the test when there is none
+func LastCall(t testing.TB, m *fake.Model) fake.Call {
+	t.Helper()
+
+	calls := m.Calls()
+	if len(calls) == 0 {
+		t.Fatalf("fake model was not called")
+	}
+
+	return calls[len(calls)-1]
+}
+
+// RequireCalls fails the test unless the model received n GenerateContent calls
+func RequireCalls(t testing.TB, m *fake.Model, n int) {
+	t.Helper()
+
+	if calls := m.Calls(); len(calls) != n {
+		t.Fatalf("fake model got %d calls, want %d", len(calls), n)
+	}
+}
+
+// RequirePrompt fails the test unless a call had the prompt, the text of its last human message
+func RequirePrompt(t testing.TB, m *fake.Model, prompt string) {
+	t.Helper()
+
+	for _, call := range m.Calls() {
+		if call.Prompt == prompt {
+			return
+		}
+	}
+
+	t.Fatalf("fake model got no prompt %q", prompt)
+}
+
+// RequireMessage fails the test unless the last call had a message of the role containing the text
+func RequireMessage(t testing.TB, m *fake.Model, role llms.ChatMessageType, substr string) {
+	t.Helper()
+
+	for _, message := range LastCall(t, m).Messages {
+		if message.Role == role && strings.Contains(messageText(message), substr) {
+			return
+		}
+	}
+
+	t.Fatalf("fake model got no %s message containing %q in the last call", role, substr)
+}
+
+// RequireScriptsUsed fails the test when a script or an enqueued response of the model was never used
+func RequireScriptsUsed(t testing.TB, m *fake.Model) {
+	t.Helper()
+
+	scripts, responses := m.Unused()
+	if len(scripts) > 0 {
+		t.Fatalf("fake model script %d was never used", scripts[0])
+	}
+	if responses > 0 {
+		t.Fatalf("fake model has %d unused responses", responses)
+	}
+}
+
+func messageText(message llms.MessageContent) string {
+	var sb strings.Builder
+	for _, part := range message.Parts {
+		if text, ok := part.(llms.TextContent); ok {
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// readRequestBody reads the request body and resets it, so it can be read again by the next transport.
+// It returns nil for requests without a body.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("io.ReadAll: %w", err)
+	}
+	_ = req.Body.Close()
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
+
+// closeRequestBody closes the body of a request which is answered without the inner transport,
+// as the http.RoundTripper contract requires
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+// requestModel returns the "model" field of a JSON request body, which both Ollama and OpenAI use
+func requestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// normalizeJSON indents the JSON body with sorted keys, after removing the ignored fields at any depth,
+// so equivalent bodies are equal strings. Bodies which are not JSON are returned as is.
+func normalizeJSON(body string, ignoreFields []string) string {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return body
+	}
+
+	// json.Marshal sorts the map keys, so the field order does not matter
+	normalized, err := json.MarshalIndent(dropFields(v, ignoreFields), "", "  ")
+	if err != nil {
+		return body
+	}
+
+	return string(normalized)
+}
+
+func dropFields(v any, fields []string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if containsFold(fields, k) {
+				delete(t, k)
+				continue
+			}
+			t[k] = dropFields(child, fields)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = dropFields(child, fields)
+		}
+	}
+
+	return v
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// drain reads the rest of a discarded body, so the connection can be reused
+func drain(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64<<10))
+	_ = body.Close()
+}
@@ -0,0 +1,280 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit of a backend
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all the requests fast with a CircuitOpenError
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through to find out whether the backend recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitOpenError is returned without sending the request while the circuit of the backend is open
+type CircuitOpenError struct {
+	Backend string
+	// RetryAt is when the next probe request is let through
+	RetryAt time.Time
+	// LastErr is the failure which opened the circuit
+	LastErr error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s until %s: %v", e.Backend, e.RetryAt.Format(time.TimeOnly), e.LastErr)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.LastErr
+}
+
+// CircuitBreakerRoundTripper stops calling a backend, identified by its host, after consecutive failures,
+// so the callers fail fast instead of waiting for their timeouts while the model server is down.
+// After the open timeout, half-open probe requests decide whether the circuit closes or opens again.
+//
+// Connection errors, 5xx responses and bodies failing while being read are failures,
+// requests canceled by their caller are not counted.
+type CircuitBreakerRoundTripper struct {
+	Transport http.RoundTripper
+
+	threshold   int
+	openTimeout time.Duration
+	probes      int
+	onChange    func(backend string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+	lastErr  error
+}
+
+// CircuitBreakerRoundTripperOption is a functional option for CircuitBreakerRoundTripper
+type CircuitBreakerRoundTripperOption func(*CircuitBreakerRoundTripper)
+
+// WithFailureThreshold sets the number of consecutive failures opening the circuit, 5 by default
+func WithFailureThreshold(n int) CircuitBreakerRoundTripperOption {
+	return func(c *CircuitBreakerRoundTripper) {
+		c.threshold = n
+	}
+}
+
+// WithOpenTimeout sets how long the circuit stays open before probing the backend, 30s by default
+func WithOpenTimeout(d time.Duration) CircuitBreakerRoundTripperOption {
+	return func(c *CircuitBreakerRoundTripper) {
+		c.openTimeout = d
+	}
+}
+
+// WithHalfOpenProbes sets how many probe requests are sent concurrently while half-open, 1 by default
+func WithHalfOpenProbes(n int) CircuitBreakerRoundTripperOption {
+	return func(c *CircuitBreakerRoundTripper) {
+		c.probes = n
+	}
+}
+
+// WithStateChange sets a callback called on every state transition, outside of the breaker lock
+func WithStateChange(fn func(backend string, from, to CircuitState)) CircuitBreakerRoundTripperOption {
+	return func(c *CircuitBreakerRoundTripper) {
+		c.onChange = fn
+	}
+}
+
+// NewCircuitBreakerRoundTripper wraps the transport, a nil transport uses the same defaults as NewLoggingRoundTripper.
+func NewCircuitBreakerRoundTripper(transport http.RoundTripper, opts ...CircuitBreakerRoundTripperOption) *CircuitBreakerRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	c := &CircuitBreakerRoundTripper{
+		Transport:   transport,
+		threshold:   5,
+		openTimeout: 30 * time.Second,
+		probes:      1,
+		circuits:    make(map[string]*circuit),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// State returns the state of the circuit of the backend host
+func (c *CircuitBreakerRoundTripper) State(backend string) CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cb, ok := c.circuits[backend]; ok {
+		return cb.state
+	}
+	return CircuitClosed
+}
+
+func (c *CircuitBreakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	backend := req.URL.Host
+
+	probe, err := c.allow(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		c.done(backend, req, probe, err)
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented {
+		c.done(backend, req, probe, fmt.Errorf("status code %d", resp.StatusCode))
+		return resp, nil
+	}
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		c.done(backend, req, probe, nil)
+		return resp, nil
+	}
+
+	resp.Body = &breakerBody{body: resp.Body, done: func(err error) {
+		c.done(backend, req, probe, err)
+	}}
+
+	return resp, nil
+}
+
+// allow returns whether the request is a half-open probe, or a CircuitOpenError
+func (c *CircuitBreakerRoundTripper) allow(backend string) (bool, error) {
+	c.mu.Lock()
+
+	cb, ok := c.circuits[backend]
+	if !ok {
+		cb = &circuit{}
+		c.circuits[backend] = cb
+	}
+
+	from := cb.state
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= c.openTimeout {
+		cb.state = CircuitHalfOpen
+	}
+
+	var probe bool
+	var err error
+	switch {
+	case cb.state == CircuitOpen, cb.state == CircuitHalfOpen && cb.probes >= c.probes:
+		err = &CircuitOpenError{Backend: backend, RetryAt: cb.openedAt.Add(c.openTimeout), LastErr: cb.lastErr}
+	case cb.state == CircuitHalfOpen:
+		cb.probes++
+		probe = true
+	}
+
+	to := cb.state
+	c.mu.Unlock()
+
+	c.changed(backend, from, to)
+
+	return probe, err
+}
+
+// done records the outcome of a request which was let through, err is nil on success
+func (c *CircuitBreakerRoundTripper) done(backend string, req *http.Request, probe bool, err error) {
+	canceled := req.Context().Err() != nil
+
+	c.mu.Lock()
+
+	cb := c.circuits[backend]
+	from := cb.state
+
+	if probe && cb.probes > 0 {
+		cb.probes--
+	}
+
+	switch {
+	case canceled:
+	case err == nil:
+		cb.failures = 0
+		if cb.state == CircuitHalfOpen {
+			cb.state = CircuitClosed
+		}
+	default:
+		cb.failures++
+		cb.lastErr = err
+		if cb.state == CircuitHalfOpen || cb.state == CircuitClosed && cb.failures >= c.threshold {
+			cb.state = CircuitOpen
+			cb.openedAt = time.Now()
+			cb.probes = 0
+		}
+	}
+
+	to := cb.state
+	c.mu.Unlock()
+
+	c.changed(backend, from, to)
+}
+
+func (c *CircuitBreakerRoundTripper) changed(backend string, from, to CircuitState) {
+	if from != to && c.onChange != nil {
+		c.onChange(backend, from, to)
+	}
+}
+
+// breakerBody calls done once, with nil when the body is read to the end or closed early by the caller
+type breakerBody struct {
+	body io.ReadCloser
+	done func(error)
+	once sync.Once
+}
+
+func (b *breakerBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			b.finish(nil)
+		} else {
+			b.finish(err)
+		}
+	}
+
+	return n, err
+}
+
+func (b *breakerBody) Close() error {
+	err := b.body.Close()
+	b.finish(nil)
+	return err
+}
+
+func (b *breakerBody) finish(err error) {
+	b.once.Do(func() {
+		b.done(err)
+	})
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerRoundTripper(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, `{"error":"llama runner process has terminated"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write([]byte(ndjsonStream))
+	}))
+	defer srv.Close()
+
+	backend := mustParseURL(t, srv.URL).Host
+
+	var mu sync.Mutex
+	var transitions []string
+
+	breaker := NewCircuitBreakerRoundTripper(http.DefaultTransport,
+		WithFailureThreshold(2),
+		WithOpenTimeout(50*time.Millisecond),
+		WithStateChange(func(b string, from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if b != backend {
+				t.Errorf("transition of backend %q, want %q", b, backend)
+			}
+			transitions = append(transitions, from.String()+"->"+to.String())
+		}),
+	)
+	client := &http.Client{Transport: breaker}
+
+	call := func() error {
+		resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+		if err != nil {
+			return err
+		}
+		_ = readAll(t, resp)
+		return nil
+	}
+
+	for range 2 {
+		if err := call(); err != nil {
+			t.Fatalf("call: %s", err)
+		}
+	}
+
+	if state := breaker.State(backend); state != CircuitOpen {
+		t.Fatalf("state is %s after 2 failures, want open", state)
+	}
+
+	var openErr *CircuitOpenError
+	if err := call(); !errors.As(err, &openErr) {
+		t.Fatalf("error is %v, want a CircuitOpenError", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("server called %d times, want 2 as the circuit is open", calls.Load())
+	}
+
+	// a failing probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if err := call(); err != nil {
+		t.Fatalf("probe: %s", err)
+	}
+	if state := breaker.State(backend); state != CircuitOpen {
+		t.Fatalf("state is %s after a failed probe, want open", state)
+	}
+
+	// a successful probe closes it
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if err := call(); err != nil {
+		t.Fatalf("probe: %s", err)
+	}
+	if state := breaker.State(backend); state != CircuitClosed {
+		t.Fatalf("state is %s after a successful probe, want closed", state)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if !slices.Equal(transitions, want) {
+		t.Fatalf("transitions are %v, want %v", transitions, want)
+	}
+}
+
+func TestCircuitBreakerRoundTripper_canceled(t *testing.T) {
+	breaker := NewCircuitBreakerRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	}), WithFailureThreshold(1))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:11434/api/chat", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+
+	if _, err := breaker.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error is %v, want context.Canceled", err)
+	}
+
+	if state := breaker.State("localhost:11434"); state != CircuitClosed {
+		t.Fatalf("state is %s after a canceled request, want closed", state)
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatalf("url.Parse: %s", err)
+	}
+	return u
+}
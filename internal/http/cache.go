@@ -0,0 +1,259 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheEntry is a cached response, replayed chunk by chunk when it was streamed
+type CacheEntry struct {
+	Response RecordedResponse `json:"response"`
+	// ExpiresAt is zero for entries which never expire
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+func (e *CacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// CacheStore stores the cached responses by key
+type CacheStore interface {
+	// Get returns nil without an error when the key is not cached
+	Get(key string) (*CacheEntry, error)
+	Set(key string, entry *CacheEntry) error
+}
+
+// MemoryCacheStore keeps the cached responses in memory
+type MemoryCacheStore struct {
+	mu      sync.RWMutex
+	entries map[string]*CacheEntry
+}
+
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: make(map[string]*CacheEntry)}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.entries[key], nil
+}
+
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = entry
+	return nil
+}
+
+// DiskCacheStore keeps every cached response in a JSON file named after its key,
+// so the cache survives between test runs.
+type DiskCacheStore struct {
+	dir string
+}
+
+func NewDiskCacheStore(dir string) *DiskCacheStore {
+	return &DiskCacheStore{dir: dir}
+}
+
+func (s *DiskCacheStore) Get(key string) (*CacheEntry, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func (s *DiskCacheStore) Set(key string, entry *CacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	// write to a temporary file first, so a concurrent Get never reads a partial entry
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("tmp.Write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("tmp.Close: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+
+	return nil
+}
+
+func (s *DiskCacheStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose requests skip the CacheRoundTripper:
+// they are neither served from the cache nor stored in it.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+// CacheStats counts the cache lookups of a CacheRoundTripper
+type CacheStats struct {
+	Hits     int64
+	Misses   int64
+	Bypasses int64
+}
+
+// CacheRoundTripper serves the repeated model calls from a CacheStore. The key is a hash of the method,
+// the URL and the normalized JSON body, so deterministic prompts (temperature 0, fixed seed) get the
+// same answer without calling the model again. Only successful responses are cached.
+//
+// Every response gets an X-Cache header, HIT or MISS, which is logged by the LoggingRoundTripper
+// when it wraps this transport.
+type CacheRoundTripper struct {
+	Transport http.RoundTripper
+
+	store    CacheStore
+	ttl      time.Duration
+	hits     atomic.Int64
+	misses   atomic.Int64
+	bypasses atomic.Int64
+}
+
+// CacheRoundTripperOption is a functional option for CacheRoundTripper
+type CacheRoundTripperOption func(*CacheRoundTripper)
+
+// WithCacheTTL sets how long the responses are served from the cache, they never expire by default
+func WithCacheTTL(ttl time.Duration) CacheRoundTripperOption {
+	return func(c *CacheRoundTripper) {
+		c.ttl = ttl
+	}
+}
+
+// NewCacheRoundTripper wraps the transport, a nil transport uses the same defaults as NewLoggingRoundTripper.
+func NewCacheRoundTripper(store CacheStore, transport http.RoundTripper, opts ...CacheRoundTripperOption) *CacheRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	c := &CacheRoundTripper{Transport: transport, store: store}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *CacheRoundTripper) Stats() CacheStats {
+	return CacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Bypasses: c.bypasses.Load(),
+	}
+}
+
+func (c *CacheRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if cacheBypassed(req.Context()) {
+		c.bypasses.Add(1)
+		return c.Transport.RoundTrip(req)
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("readRequestBody: %w", err)
+	}
+
+	key := cacheKey(req, body)
+
+	entry, err := c.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("store.Get: %w", err)
+	}
+
+	if entry != nil && !entry.expired(time.Now()) {
+		c.hits.Add(1)
+
+		resp := entry.Response.toHTTP(req)
+		resp.Header.Set("X-Cache", "HIT")
+		return resp, nil
+	}
+
+	c.misses.Add(1)
+
+	resp, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, nil
+	}
+
+	// the recorded header must not carry the X-Cache of this response
+	recordedHeader := resp.Header.Clone()
+	resp.Header.Set("X-Cache", "MISS")
+
+	resp.Body = &recordingBody{
+		body: resp.Body,
+		done: func(data []byte) {
+			recorded := recordResponse(&http.Response{StatusCode: resp.StatusCode, Header: recordedHeader}, data)
+
+			entry := &CacheEntry{Response: recorded}
+			if c.ttl > 0 {
+				entry.ExpiresAt = time.Now().Add(c.ttl)
+			}
+
+			if err := c.store.Set(key, entry); err != nil {
+				slog.Error("cache store.Set", slog.String("error", err.Error()))
+			}
+		},
+	}
+
+	return resp, nil
+}
+
+func cacheKey(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + "\n" + req.URL.String() + "\n"))
+	h.Write([]byte(normalizeJSON(string(body), nil)))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCountingNDJSONServer(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = io.WriteString(w, ndjsonStream)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("io.ReadAll: %s", err)
+	}
+	return string(body)
+}
+
+func TestCacheRoundTripper(t *testing.T) {
+	stores := map[string]CacheStore{
+		"memory": NewMemoryCacheStore(),
+		"disk":   NewDiskCacheStore(t.TempDir()),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := newCountingNDJSONServer(t, &calls)
+
+			cache := NewCacheRoundTripper(store, http.DefaultTransport)
+			client := &http.Client{Transport: cache}
+
+			resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2","options":{"seed":42}}`)
+			if err != nil {
+				t.Fatalf("post: %s", err)
+			}
+			if got := resp.Header.Get("X-Cache"); got != "MISS" {
+				t.Fatalf("X-Cache is %q, want MISS", got)
+			}
+			_ = readAll(t, resp)
+
+			// same body with another field order and spacing
+			resp, err = post(t, client, srv.URL+"/api/chat", `{ "options": {"seed": 42}, "model": "llama3.2" }`)
+			if err != nil {
+				t.Fatalf("post: %s", err)
+			}
+			if got := resp.Header.Get("X-Cache"); got != "HIT" {
+				t.Fatalf("X-Cache is %q, want HIT", got)
+			}
+
+			buf := make([]byte, 4096)
+			n, err := resp.Body.Read(buf)
+			if err != nil {
+				t.Fatalf("Read: %s", err)
+			}
+			if first := strings.SplitAfter(ndjsonStream, "\n")[0]; string(buf[:n]) != first {
+				t.Fatalf("first chunk is %q, want %q", buf[:n], first)
+			}
+			if got := string(buf[:n]) + readAll(t, resp); got != ndjsonStream {
+				t.Fatalf("cached body is %q, want %q", got, ndjsonStream)
+			}
+
+			if calls.Load() != 1 {
+				t.Fatalf("server called %d times, want 1", calls.Load())
+			}
+
+			req, err := http.NewRequestWithContext(WithCacheBypass(t.Context()), http.MethodPost, srv.URL+"/api/chat",
+				strings.NewReader(`{"model":"llama3.2","options":{"seed":42}}`))
+			if err != nil {
+				t.Fatalf("http.NewRequest: %s", err)
+			}
+			resp, err = client.Do(req)
+			if err != nil {
+				t.Fatalf("client.Do: %s", err)
+			}
+			_ = readAll(t, resp)
+
+			if calls.Load() != 2 {
+				t.Fatalf("server called %d times with bypass, want 2", calls.Load())
+			}
+
+			if stats := cache.Stats(); stats != (CacheStats{Hits: 1, Misses: 1, Bypasses: 1}) {
+				t.Fatalf("unexpected stats: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCacheRoundTripper_ttl(t *testing.T) {
+	var calls atomic.Int32
+	srv := newCountingNDJSONServer(t, &calls)
+
+	client := &http.Client{Transport: NewCacheRoundTripper(NewMemoryCacheStore(), http.DefaultTransport,
+		WithCacheTTL(time.Nanosecond),
+	)}
+
+	for range 2 {
+		resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+		if err != nil {
+			t.Fatalf("post: %s", err)
+		}
+		_ = readAll(t, resp)
+		time.Sleep(time.Millisecond)
+	}
+
+	if calls.Load() != 2 {
+		t.Fatalf("server called %d times, want 2 as the entry expired", calls.Load())
+	}
+}
@@ -0,0 +1,433 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CassetteMode defines whether a Cassette is allowed to reach the network.
+type CassetteMode int
+
+const (
+	// CassetteModeReplay serves the responses from the cassette file only.
+	// A request without a recorded match fails with a *CassetteMissError.
+	CassetteModeReplay CassetteMode = iota
+	// CassetteModeRecord sends every request to the network and overwrites the cassette file.
+	CassetteModeRecord
+	// CassetteModeReplayOrRecord replays the recorded requests and records the missing ones.
+	CassetteModeReplayOrRecord
+)
+
+func (m CassetteMode) String() string {
+	switch m {
+	case CassetteModeReplay:
+		return "replay"
+	case CassetteModeRecord:
+		return "record"
+	case CassetteModeReplayOrRecord:
+		return "replay-or-record"
+	default:
+		return fmt.Sprintf("CassetteMode(%d)", int(m))
+	}
+}
+
+// ParseCassetteMode parses the mode names returned by CassetteMode.String,
+// useful to select the mode from an environment variable.
+func ParseCassetteMode(s string) (CassetteMode, error) {
+	for _, m := range []CassetteMode{CassetteModeReplay, CassetteModeRecord, CassetteModeReplayOrRecord} {
+		if strings.EqualFold(s, m.String()) {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown cassette mode: %q", s)
+}
+
+// Interaction is a single request/response pair stored in a cassette.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// Chunks holds the lines of a streamed body (NDJSON or SSE) in the order they were received,
+	// so they can be replayed one by one.
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// CassetteMatcher defines which parts of a request must be equal to a recorded one to replay it.
+type CassetteMatcher struct {
+	Method bool
+	URL    bool
+	Body   bool
+	// IgnoreFields are JSON object keys removed from the request bodies at any depth before comparing them,
+	// e.g. the seed or timestamps which change from run to run.
+	IgnoreFields []string
+}
+
+// DefaultCassetteMatcher matches the method, the URL and the JSON body ignoring the seed and timestamps.
+func DefaultCassetteMatcher() CassetteMatcher {
+	return CassetteMatcher{
+		Method:       true,
+		URL:          true,
+		Body:         true,
+		IgnoreFields: []string{"seed", "created_at", "timestamp"},
+	}
+}
+
+// key returns the normalized form of the request, two requests match if their keys are equal.
+func (m CassetteMatcher) key(req RecordedRequest) string {
+	var sb strings.Builder
+
+	if m.Method {
+		sb.WriteString(req.Method + "\n")
+	}
+	if m.URL {
+		sb.WriteString(req.URL + "\n")
+	}
+	if m.Body {
+		sb.WriteString(normalizeJSON(req.Body, m.IgnoreFields))
+	}
+
+	return sb.String()
+}
+
+// CassetteMissError is returned in replay mode when no recorded request matches.
+type CassetteMissError struct {
+	Request RecordedRequest
+	// Closest is the recorded request with the smallest difference, nil if the cassette is empty
+	Closest *RecordedRequest
+	// Diff is a line diff between the closest recorded request (-) and the actual one (+)
+	Diff string
+}
+
+func (e *CassetteMissError) Error() string {
+	if e.Closest == nil {
+		return fmt.Sprintf("cassette: no recorded interaction for %s %s, cassette is empty", e.Request.Method, e.Request.URL)
+	}
+
+	return fmt.Sprintf("cassette: no recorded interaction for %s %s, closest recorded request:\n%s",
+		e.Request.Method, e.Request.URL, e.Diff)
+}
+
+// CassetteOption is a functional option for Cassette
+type CassetteOption func(*Cassette)
+
+// WithCassetteMatcher overrides the DefaultCassetteMatcher
+func WithCassetteMatcher(matcher CassetteMatcher) CassetteOption {
+	return func(c *Cassette) {
+		c.matcher = matcher
+	}
+}
+
+// Cassette stores the HTTP interactions with a model server in a JSON file,
+// so tests can be replayed without the server running.
+type Cassette struct {
+	path    string
+	mode    CassetteMode
+	matcher CassetteMatcher
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	replayed     map[*Interaction]bool
+}
+
+// NewCassette creates a cassette backed by the file at path.
+// In CassetteModeReplay the file must exist, in CassetteModeReplayOrRecord it is loaded if present,
+// and in CassetteModeRecord it is overwritten once the first interaction is recorded.
+func NewCassette(path string, mode CassetteMode, opts ...CassetteOption) (*Cassette, error) {
+	c := &Cassette{
+		path:     path,
+		mode:     mode,
+		matcher:  DefaultCassetteMatcher(),
+		replayed: make(map[*Interaction]bool),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if mode == CassetteModeRecord {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if mode == CassetteModeReplayOrRecord && errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal[%s]: %w", path, err)
+	}
+	c.interactions = file.Interactions
+
+	return c, nil
+}
+
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Interactions returns a copy of the recorded interactions
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]Interaction, 0, len(c.interactions))
+	for _, i := range c.interactions {
+		result = append(result, *i)
+	}
+
+	return result
+}
+
+// find returns the interaction matching the request. Interactions which have not been replayed yet
+// are preferred, so the same request sent twice gets the responses in the recorded order.
+func (c *Cassette) find(req RecordedRequest) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := c.matcher.key(req)
+
+	var match *Interaction
+	for _, i := range c.interactions {
+		if c.matcher.key(i.Request) != key {
+			continue
+		}
+		if !c.replayed[i] {
+			c.replayed[i] = true
+			return i, nil
+		}
+		if match == nil {
+			match = i
+		}
+	}
+
+	if match != nil {
+		return match, nil
+	}
+
+	missErr := &CassetteMissError{Request: req}
+
+	minChanges := -1
+	for _, i := range c.interactions {
+		diff, changes := lineDiff(c.matcher.key(i.Request), key)
+		if minChanges == -1 || changes < minChanges {
+			minChanges = changes
+			closest := i.Request
+			missErr.Closest = &closest
+			missErr.Diff = diff
+		}
+	}
+
+	return nil, missErr
+}
+
+func (c *Cassette) add(i *Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, i)
+	c.replayed[i] = true
+
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	if err := os.WriteFile(c.path, data, 0o644); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	return nil
+}
+
+// CassetteRoundTripper records the requests to a Cassette or replays them from it,
+// depending on the cassette mode.
+type CassetteRoundTripper struct {
+	Transport http.RoundTripper
+	cassette  *Cassette
+}
+
+func NewCassetteRoundTripper(cassette *Cassette, transport http.RoundTripper) *CassetteRoundTripper {
+	return &CassetteRoundTripper{Transport: transport, cassette: cassette}
+}
+
+func (c *CassetteRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("recordRequest: %w", err)
+	}
+
+	if c.cassette.mode != CassetteModeRecord {
+		interaction, err := c.cassette.find(recorded)
+		if err == nil {
+			return interaction.Response.toHTTP(req), nil
+		}
+
+		var missErr *CassetteMissError
+		if c.cassette.mode == CassetteModeReplay || !errors.As(err, &missErr) {
+			return nil, err
+		}
+	}
+
+	resp, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("RoundTrip: %w", err)
+	}
+
+	resp.Body = &recordingBody{
+		body: resp.Body,
+		done: func(body []byte) {
+			interaction := &Interaction{
+				Request:  recorded,
+				Response: recordResponse(resp, body),
+			}
+			if err := c.cassette.add(interaction); err != nil {
+				slog.Error("cassette.add", slog.String("error", err.Error()))
+			}
+		},
+	}
+
+	return resp, nil
+}
+
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	recorded := RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return recorded, fmt.Errorf("readRequestBody: %w", err)
+	}
+	recorded.Body = string(body)
+
+	return recorded, nil
+}
+
+func recordResponse(resp *http.Response, body []byte) RecordedResponse {
+	recorded := RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+	}
+
+	if !isStream(resp.Header) {
+		recorded.Body = string(body)
+		return recorded
+	}
+
+	for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+		if len(line) > 0 {
+			recorded.Chunks = append(recorded.Chunks, string(line))
+		}
+	}
+
+	return recorded
+}
+
+func (r RecordedResponse) toHTTP(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	var body io.Reader = strings.NewReader(r.Body)
+	contentLength := int64(len(r.Body))
+	if len(r.Chunks) > 0 {
+		body = &chunkReader{chunks: r.Chunks}
+		contentLength = -1
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(body),
+		ContentLength: contentLength,
+		Request:       req,
+	}
+}
+
+// chunkReader returns at most one chunk per Read call, so streamed responses
+// are replayed chunk by chunk as they were received.
+type chunkReader struct {
+	chunks []string
+	offset int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.chunks[0][r.offset:])
+	r.offset += n
+
+	if r.offset == len(r.chunks[0]) {
+		r.chunks = r.chunks[1:]
+		r.offset = 0
+	}
+
+	return n, nil
+}
+
+// recordingBody copies the body while the caller reads it and calls done once it is fully read.
+// A body closed before EOF is not recorded, as it would be replayed truncated.
+type recordingBody struct {
+	body io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+func (r *recordingBody) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.buf.Write(p[:n])
+
+	if errors.Is(err, io.EOF) {
+		r.once.Do(func() {
+			r.done(r.buf.Bytes())
+		})
+	}
+
+	return n, err
+}
+
+func (r *recordingBody) Close() error {
+	return r.body.Close()
+}
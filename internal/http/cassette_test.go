@@ -0,0 +1,148 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var offlineTransport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("network is not available in replay mode")
+})
+
+const ndjsonStream = `{"model":"llama3.2","message":{"role":"assistant","content":"Hello"},"done":false}
+{"model":"llama3.2","message":{"role":"assistant","content":" there"},"done":false}
+{"model":"llama3.2","message":{"role":"assistant","content":""},"done_reason":"stop","done":true,"eval_count":2}
+`
+
+func newNDJSONServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = io.WriteString(w, ndjsonStream)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func post(t *testing.T, client *http.Client, url string, body string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+
+	return client.Do(req)
+}
+
+func TestCassette_recordAndReplay(t *testing.T) {
+	srv := newNDJSONServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := NewCassette(path, CassetteModeRecord)
+	if err != nil {
+		t.Fatalf("NewCassette: %s", err)
+	}
+
+	client := &http.Client{Transport: NewCassetteRoundTripper(recorder, http.DefaultTransport)}
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2","options":{"seed":42}}`)
+	if err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("io.ReadAll: %s", err)
+	}
+	_ = resp.Body.Close()
+
+	player, err := NewCassette(path, CassetteModeReplay)
+	if err != nil {
+		t.Fatalf("NewCassette: %s", err)
+	}
+
+	interactions := player.Interactions()
+	if len(interactions) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(interactions))
+	}
+	if got := len(interactions[0].Response.Chunks); got != 3 {
+		t.Fatalf("recorded %d chunks, want 3", got)
+	}
+
+	client = &http.Client{Transport: NewCassetteRoundTripper(player, offlineTransport)}
+
+	// the seed is ignored by the default matcher, and the field order does not matter
+	resp, err = post(t, client, srv.URL+"/api/chat", `{"options":{"seed":7},"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+	defer resp.Body.Close()
+
+	buf := make([]byte, 4096)
+	n, err := resp.Body.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+	if first := strings.SplitAfter(ndjsonStream, "\n")[0]; string(buf[:n]) != first {
+		t.Fatalf("first chunk is %q, want %q", buf[:n], first)
+	}
+
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("io.ReadAll: %s", err)
+	}
+	if got := string(buf[:n]) + string(rest); got != ndjsonStream {
+		t.Fatalf("replayed body is %q, want %q", got, ndjsonStream)
+	}
+}
+
+func TestCassette_replayMiss(t *testing.T) {
+	srv := newNDJSONServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := NewCassette(path, CassetteModeRecord)
+	if err != nil {
+		t.Fatalf("NewCassette: %s", err)
+	}
+
+	client := &http.Client{Transport: NewCassetteRoundTripper(recorder, http.DefaultTransport)}
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2","prompt":"Why is the sky blue?"}`)
+	if err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	player, err := NewCassette(path, CassetteModeReplay)
+	if err != nil {
+		t.Fatalf("NewCassette: %s", err)
+	}
+
+	client = &http.Client{Transport: NewCassetteRoundTripper(player, offlineTransport)}
+
+	_, err = post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2","prompt":"Why is the grass green?"}`)
+
+	var missErr *CassetteMissError
+	if !errors.As(err, &missErr) {
+		t.Fatalf("error is %v, want *CassetteMissError", err)
+	}
+	if !strings.Contains(missErr.Diff, `-   "prompt": "Why is the sky blue?"`) {
+		t.Fatalf("diff does not contain the recorded prompt:\n%s", missErr.Diff)
+	}
+	if !strings.Contains(missErr.Diff, `+   "prompt": "Why is the grass green?"`) {
+		t.Fatalf("diff does not contain the actual prompt:\n%s", missErr.Diff)
+	}
+}
@@ -0,0 +1,313 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is returned, wrapped, by the failures injected by the ChaosRoundTripper
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultKind names a failure injected by the ChaosRoundTripper
+type FaultKind string
+
+const (
+	FaultLatency        FaultKind = "latency"
+	FaultError          FaultKind = "error"
+	FaultStatus         FaultKind = "status"
+	FaultTruncate       FaultKind = "truncate"
+	FaultCorruptFrame   FaultKind = "corrupt_frame"
+	FaultErrorFrame     FaultKind = "error_frame"
+	FaultDropConnection FaultKind = "drop_connection"
+)
+
+// ChaosProfile configures the failures injected by the ChaosRoundTripper. Every rate is the probability,
+// between 0 and 1, of injecting that failure into a request: use 1 for a failure on every request,
+// or a seed with WithChaosSeed to get a reproducible sequence of failures.
+type ChaosProfile struct {
+	// Latency is added before sending every request, plus a random duration up to LatencyJitter
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	// ErrorRate fails the request before sending it, as if the server was not reachable
+	ErrorRate float64
+
+	// StatusRate responds with StatusCode, 500 by default, without sending the request
+	StatusRate float64
+	StatusCode int
+
+	// TruncateRate ends the body cleanly after TruncateAfterBytes, e.g. a stream without its final frame
+	TruncateRate       float64
+	TruncateAfterBytes int
+
+	// CorruptFrameRate cuts the NDJSON frame at FrameIndex in half, making it malformed JSON.
+	// A body which is not streamed is a single frame.
+	CorruptFrameRate float64
+	// ErrorFrameRate replaces the NDJSON frame at FrameIndex with an Ollama error frame,
+	// as sent when the server fails in the middle of a stream.
+	ErrorFrameRate float64
+	FrameIndex     int
+
+	// DropRate fails the body read with an unexpected EOF after DropAfterBytes, as a dropped connection
+	DropRate       float64
+	DropAfterBytes int
+}
+
+// ChaosRoundTripper injects failures into the model calls, to test how the clients behave when
+// the model server is slow, fails, or sends broken responses.
+type ChaosRoundTripper struct {
+	Transport http.RoundTripper
+	profile   ChaosProfile
+
+	mu     sync.Mutex
+	rnd    *rand.Rand
+	faults map[FaultKind]int
+}
+
+// ChaosRoundTripperOption is a functional option for ChaosRoundTripper
+type ChaosRoundTripperOption func(*ChaosRoundTripper)
+
+// WithChaosSeed makes the sequence of injected failures reproducible
+func WithChaosSeed(seed uint64) ChaosRoundTripperOption {
+	return func(c *ChaosRoundTripper) {
+		c.rnd = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// NewChaosRoundTripper wraps the transport, a nil transport uses the same defaults as NewLoggingRoundTripper.
+func NewChaosRoundTripper(profile ChaosProfile, transport http.RoundTripper, opts ...ChaosRoundTripperOption) *ChaosRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	if profile.StatusCode == 0 {
+		profile.StatusCode = http.StatusInternalServerError
+	}
+
+	c := &ChaosRoundTripper{
+		Transport: transport,
+		profile:   profile,
+		rnd:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+		faults:    make(map[FaultKind]int),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Faults returns how many times every failure has been injected
+func (c *ChaosRoundTripper) Faults() map[FaultKind]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[FaultKind]int, len(c.faults))
+	for k, v := range c.faults {
+		result[k] = v
+	}
+	return result
+}
+
+// chaosPlan holds the failures drawn for a request
+type chaosPlan struct {
+	latency        time.Duration
+	err            bool
+	status         bool
+	truncate       bool
+	corruptFrame   bool
+	errorFrame     bool
+	dropConnection bool
+}
+
+// plan draws all the failures of a request at once, so the sequence only depends on the seed
+// and not on how the bodies are read.
+func (c *ChaosRoundTripper) plan() chaosPlan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.profile
+
+	var plan chaosPlan
+	plan.latency = p.Latency
+	if p.LatencyJitter > 0 {
+		plan.latency += time.Duration(c.rnd.Int64N(int64(p.LatencyJitter)))
+	}
+
+	plan.err = c.draw(p.ErrorRate, FaultError)
+	plan.status = c.draw(p.StatusRate, FaultStatus)
+	plan.truncate = c.draw(p.TruncateRate, FaultTruncate)
+	plan.corruptFrame = c.draw(p.CorruptFrameRate, FaultCorruptFrame)
+	plan.errorFrame = c.draw(p.ErrorFrameRate, FaultErrorFrame)
+	plan.dropConnection = c.draw(p.DropRate, FaultDropConnection)
+
+	if plan.latency > 0 {
+		c.faults[FaultLatency]++
+	}
+
+	return plan
+}
+
+// draw must be called with the mutex held
+func (c *ChaosRoundTripper) draw(rate float64, kind FaultKind) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	if c.rnd.Float64() >= rate {
+		return false
+	}
+
+	c.faults[kind]++
+	return true
+}
+
+func (c *ChaosRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	plan := c.plan()
+
+	if plan.latency > 0 {
+		if err := sleep(req.Context(), plan.latency); err != nil {
+			closeRequestBody(req)
+			return nil, err
+		}
+	}
+
+	if plan.err {
+		closeRequestBody(req)
+		return nil, fmt.Errorf("%w: connection refused", ErrInjectedFault)
+	}
+
+	if plan.status {
+		closeRequestBody(req)
+		body := fmt.Sprintf(`{"error":"%s: %s"}`, ErrInjectedFault, http.StatusText(c.profile.StatusCode))
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", c.profile.StatusCode, http.StatusText(c.profile.StatusCode)),
+			StatusCode:    c.profile.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.corruptFrame || plan.errorFrame {
+		resp.Body = &frameFaultBody{
+			body:       resp.Body,
+			reader:     bufio.NewReader(resp.Body),
+			index:      c.profile.FrameIndex,
+			errorFrame: plan.errorFrame,
+		}
+	}
+
+	if plan.truncate {
+		resp.Body = &limitedBody{body: resp.Body, remaining: c.profile.TruncateAfterBytes, err: io.EOF}
+	}
+
+	if plan.dropConnection {
+		resp.Body = &limitedBody{
+			body:      resp.Body,
+			remaining: c.profile.DropAfterBytes,
+			err:       fmt.Errorf("%w: connection dropped: %w", ErrInjectedFault, io.ErrUnexpectedEOF),
+		}
+	}
+
+	if plan.truncate || plan.dropConnection || plan.corruptFrame || plan.errorFrame {
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	}
+
+	return resp, nil
+}
+
+// limitedBody returns err once remaining bytes have been read
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int
+	err       error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, l.err
+	}
+
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.body.Read(p)
+	l.remaining -= n
+
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.body.Close()
+}
+
+// frameFaultBody breaks the frame at index of a NDJSON body, only the current line is buffered
+type frameFaultBody struct {
+	body       io.ReadCloser
+	reader     *bufio.Reader
+	index      int
+	errorFrame bool
+
+	frame   int
+	pending []byte
+	err     error
+}
+
+func (f *frameFaultBody) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+
+		line, err := f.reader.ReadBytes('\n')
+		f.err = err
+
+		if len(line) > 0 {
+			if f.frame == f.index {
+				line = f.breakFrame(line)
+			}
+			f.frame++
+		}
+
+		f.pending = line
+	}
+
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+
+	return n, nil
+}
+
+func (f *frameFaultBody) breakFrame(line []byte) []byte {
+	if f.errorFrame {
+		return []byte(fmt.Sprintf(`{"error":"%s: model runner stopped"}`+"\n", ErrInjectedFault))
+	}
+
+	// cut the JSON object in half, keeping the newline so the next frames are still readable
+	trimmed := strings.TrimRight(string(line), "\n")
+	return []byte(trimmed[:len(trimmed)/2] + "\n")
+}
+
+func (f *frameFaultBody) Close() error {
+	return f.body.Close()
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestChaosRoundTripper_error(t *testing.T) {
+	srv := newNDJSONServer(t)
+
+	chaos := NewChaosRoundTripper(ChaosProfile{ErrorRate: 1}, http.DefaultTransport)
+	client := &http.Client{Transport: chaos}
+
+	_, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+	if !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("error is %v, want ErrInjectedFault", err)
+	}
+
+	if got := chaos.Faults()[FaultError]; got != 1 {
+		t.Fatalf("injected %d errors, want 1", got)
+	}
+}
+
+func TestChaosRoundTripper_status(t *testing.T) {
+	srv := newNDJSONServer(t)
+
+	client := &http.Client{Transport: NewChaosRoundTripper(ChaosProfile{StatusRate: 1, StatusCode: http.StatusServiceUnavailable}, http.DefaultTransport)}
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status is %d, want 503", resp.StatusCode)
+	}
+	if body := readAll(t, resp); !strings.Contains(body, `"error"`) {
+		t.Fatalf("body is %q, want an error", body)
+	}
+}
+
+func TestChaosRoundTripper_corruptFrame(t *testing.T) {
+	srv := newNDJSONServer(t)
+
+	client := &http.Client{Transport: NewChaosRoundTripper(ChaosProfile{CorruptFrameRate: 1, FrameIndex: 1}, http.DefaultTransport)}
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+
+	frames := strings.SplitAfter(readAll(t, resp), "\n")
+	want := strings.SplitAfter(ndjsonStream, "\n")
+
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d: %q", len(frames), len(want), frames)
+	}
+	if frames[0] != want[0] || frames[2] != want[2] {
+		t.Fatalf("frames around the corrupted one changed: %q", frames)
+	}
+	if frames[1] == want[1] || !strings.HasPrefix(want[1], strings.TrimSuffix(frames[1], "\n")) {
+		t.Fatalf("frame 1 is %q, want a prefix of %q", frames[1], want[1])
+	}
+}
+
+func TestChaosRoundTripper_dropConnection(t *testing.T) {
+	srv := newNDJSONServer(t)
+
+	client := &http.Client{Transport: NewChaosRoundTripper(ChaosProfile{DropRate: 1, DropAfterBytes: 10}, http.DefaultTransport)}
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("error is %v, want an injected unexpected EOF", err)
+	}
+	if string(body) != ndjsonStream[:10] {
+		t.Fatalf("body is %q, want %q", body, ndjsonStream[:10])
+	}
+}
+
+func TestChaosRoundTripper_seed(t *testing.T) {
+	sequence := func() []bool {
+		chaos := NewChaosRoundTripper(ChaosProfile{ErrorRate: 0.5}, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+		}), WithChaosSeed(42))
+
+		var failed []bool
+		for range 32 {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://localhost/api/tags", nil)
+			if err != nil {
+				t.Fatalf("http.NewRequest: %s", err)
+			}
+
+			_, err = chaos.RoundTrip(req)
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := sequence(), sequence()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("request %d differs between runs with the same seed: %v, %v", i, first, second)
+		}
+	}
+}
+
+// closeTracker records whether the request body was closed
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestChaosRoundTripper_closesRequestBody(t *testing.T) {
+	for name, profile := range map[string]ChaosProfile{
+		"error":  {ErrorRate: 1},
+		"status": {StatusRate: 1, StatusCode: http.StatusServiceUnavailable},
+	} {
+		t.Run(name, func(t *testing.T) {
+			body := &closeTracker{Reader: strings.NewReader(`{"model":"llama3.2"}`)}
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "http://localhost:11434/api/chat", body)
+			if err != nil {
+				t.Fatalf("http.NewRequest: %s", err)
+			}
+
+			resp, _ := NewChaosRoundTripper(profile, http.DefaultTransport).RoundTrip(req)
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			if !body.closed {
+				t.Fatalf("request body is not closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HAR is an HTTP Archive 1.2 document, which can be opened by the browser dev tools or replayed by most HTTP clients.
+// See http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	// Error is set when no response was received, custom fields start with an underscore
+	Error string `json:"_error,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARTimings are in milliseconds. HAR 1.2 requires send, wait and receive to be non-negative,
+// the request is written by the transport so its send is 0.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorder writes the requests of a session to a HAR file. The file is rewritten after every entry,
+// so it is complete even when the program exits without closing anything.
+type HARRecorder struct {
+	path string
+
+	mu  sync.Mutex
+	har HAR
+}
+
+// NewHARRecorder starts a session, an existing file at path is replaced
+func NewHARRecorder(path string) *HARRecorder {
+	return &HARRecorder{
+		path: path,
+		har: HAR{Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "genai-go", Version: "1.0"},
+			Entries: []*HAREntry{},
+		}},
+	}
+}
+
+// Entries returns the entries recorded so far
+func (r *HARRecorder) Entries() []*HAREntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.har.Log.Entries)
+}
+
+func (r *HARRecorder) add(entry *HAREntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.har.Log.Entries = append(r.har.Log.Entries, entry)
+
+	data, err := json.MarshalIndent(r.har, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	if dir := filepath.Dir(r.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("os.MkdirAll: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(r.path, data, 0o644); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+
+	return nil
+}
+
+func newHAREntry(req *http.Request, body []byte, redactedHeaders []string, started time.Time) *HAREntry {
+	entry := &HAREntry{
+		StartedDateTime: started,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(redactHeaders(req.Header, redactedHeaders)),
+			QueryString: []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+	}
+
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	if body != nil {
+		mimeType := req.Header.Get("Content-Type")
+		if mimeType == "" {
+			mimeType = "application/json"
+		}
+		entry.Request.PostData = &HARPostData{MimeType: mimeType, Text: string(body)}
+	}
+
+	return entry
+}
+
+func (e *HAREntry) setResponse(resp *http.Response, body []byte, redactedHeaders []string) {
+	e.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(redactHeaders(resp.Header, redactedHeaders)),
+		Content: HARContent{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     string(body),
+		},
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+}
+
+// setError fills the mandatory response fields for a request which got no response
+func (e *HAREntry) setError(err error) {
+	e.Error = err.Error()
+	e.Response = HARResponse{
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARNameValue{},
+		Headers:     []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+// setTimings splits the time of the entry into the wait for the first byte of the body and its receive,
+// a zero firstByte, e.g. for an empty body, counts all of it as the wait
+func (e *HAREntry) setTimings(started, firstByte, done time.Time) {
+	e.Time = milliseconds(done.Sub(started))
+	e.Timings = HARTimings{Wait: e.Time}
+
+	if !firstByte.IsZero() {
+		e.Timings.Wait = milliseconds(firstByte.Sub(started))
+		e.Timings.Receive = milliseconds(done.Sub(firstByte))
+	}
+}
+
+// firstByteWriter records when its first bytes were written
+type firstByteWriter struct {
+	w     io.Writer
+	first time.Time
+}
+
+func (f *firstByteWriter) Write(p []byte) (int, error) {
+	if f.first.IsZero() && len(p) > 0 {
+		f.first = time.Now()
+	}
+	return f.w.Write(p)
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	result := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range header.Values(name) {
+			result = append(result, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	return result
+}
+
+// curlCommand returns a shell command sending the same request, the redacted headers have to be filled in
+func curlCommand(req *http.Request, body []byte, redactedHeaders []string) string {
+	var sb strings.Builder
+
+	sb.WriteString("curl -X " + req.Method + " " + shellQuote(req.URL.String()))
+
+	for _, h := range harHeaders(redactHeaders(req.Header, redactedHeaders)) {
+		sb.WriteString(" -H " + shellQuote(h.Name+": "+h.Value))
+	}
+
+	if body != nil {
+		sb.WriteString(" --data-raw " + shellQuote(string(body)))
+	}
+
+	return sb.String()
+}
+
+// shellQuote wraps s in single quotes, which keep everything literal in POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggingRoundTripper_har(t *testing.T) {
+	srv := newNDJSONServer(t)
+	path := filepath.Join(t.TempDir(), "session.har")
+
+	// the HAR file is written even when the records are not logged
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	client := &http.Client{Transport: NewLoggingRoundTripper(
+		WithLogger(logger),
+		WithHAR(NewHARRecorder(path)),
+	)}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, srv.URL+"/api/chat",
+		strings.NewReader(`{"model":"llama3.2","images":["aGVsbG8="]}`))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do: %s", err)
+	}
+	_ = readAll(t, resp)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile: %s", err)
+	}
+
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("json.Unmarshal: %s", err)
+	}
+
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 1 {
+		t.Fatalf("unexpected HAR log: %s", data)
+	}
+
+	entry := har.Log.Entries[0]
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"model":"llama3.2","images":["aGVsbG8="]}` {
+		t.Errorf("request body is not recorded as sent: %+v", entry.Request.PostData)
+	}
+	if entry.Response.Status != http.StatusOK || entry.Response.Content.Text != ndjsonStream {
+		t.Errorf("unexpected response: %+v", entry.Response)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("HAR file contains the Authorization header:\n%s", data)
+	}
+	requireHARTimings(t, entry)
+}
+
+func TestLoggingRoundTripper_harError(t *testing.T) {
+	srv := newNDJSONServer(t)
+	srv.Close()
+
+	recorder := NewHARRecorder(filepath.Join(t.TempDir(), "session.har"))
+	client := &http.Client{Transport: NewLoggingRoundTripper(WithHAR(recorder))}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/api/tags", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+	if _, err := client.Do(req); err == nil {
+		t.Fatalf("request to a closed server succeeded")
+	}
+
+	entries := recorder.Entries()
+	if len(entries) != 1 || entries[0].Error == "" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	requireHARTimings(t, entries[0])
+}
+
+// requireHARTimings fails unless the timings are valid in HAR 1.2 and add up to the time of the entry
+func requireHARTimings(t *testing.T, entry *HAREntry) {
+	t.Helper()
+
+	timings := entry.Timings
+	if timings.Send < 0 || timings.Wait < 0 || timings.Receive < 0 {
+		t.Fatalf("negative timings: %+v", timings)
+	}
+	if sum := timings.Send + timings.Wait + timings.Receive; math.Abs(sum-entry.Time) > 1e-6 {
+		t.Fatalf("timings add up to %f, want the time %f", sum, entry.Time)
+	}
+}
+
+func TestCurlCommand(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:11434/api/chat", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Api-Key", "secret")
+
+	got := curlCommand(req, []byte(`{"content":"What's up?"}`), DefaultRedactedHeaders)
+	want := `curl -X POST 'http://localhost:11434/api/chat' -H 'Api-Key: [REDACTED]' -H 'Content-Type: application/json' --data-raw '{"content":"What'\''s up?"}'`
+
+	if got != want {
+		t.Fatalf("curl command is\n%s\nwant\n%s", got, want)
+	}
+}
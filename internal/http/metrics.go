@@ -0,0 +1,310 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLatencyBuckets are the upper bounds in seconds of the request latency histogram
+	DefaultLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	// DefaultTokenBuckets are the upper bounds of the completion tokens per request histogram
+	DefaultTokenBuckets = []float64{16, 64, 256, 1024, 4096, 16384}
+	// DefaultQueueWaitBuckets are the upper bounds in seconds of the rate limit queue wait histogram
+	DefaultQueueWaitBuckets = []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 30}
+)
+
+// MetricsKey identifies the series of a model called through an endpoint, e.g. llama3.2 and /api/chat
+type MetricsKey struct {
+	Model    string
+	Endpoint string
+}
+
+// ModelStats is a snapshot of the metrics of a model and endpoint.
+type ModelStats struct {
+	MetricsKey
+
+	Requests         int64
+	Errors           int64
+	PromptTokens     int64
+	CompletionTokens int64
+	// LoadDuration and TotalDuration are the sums of the durations reported by Ollama
+	LoadDuration  time.Duration
+	TotalDuration time.Duration
+	// Latency is measured by the client, in seconds, from sending the request to reading the whole body
+	Latency                    Histogram
+	CompletionTokensPerRequest Histogram
+	// QueueWait is the time, in seconds, the calls waited for a RateLimitRoundTripper before being sent
+	QueueWait Histogram
+}
+
+// Histogram counts the observations per bucket, Counts[i] is the number of observations
+// less or equal than Bounds[i] and greater than Bounds[i-1], the last count is the +Inf bucket.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+func newHistogram(bounds []float64) Histogram {
+	return Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(h.Bounds, v)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// Metrics aggregates the token usage and the latency of the model calls per model and endpoint.
+// It is safe for concurrent use.
+type Metrics struct {
+	mu     sync.Mutex
+	series map[MetricsKey]*ModelStats
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{series: make(map[MetricsKey]*ModelStats)}
+}
+
+// Snapshot returns the current metrics sorted by model and endpoint
+func (m *Metrics) Snapshot() []ModelStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]ModelStats, 0, len(m.series))
+	for _, s := range m.series {
+		stats := *s
+		stats.Latency = s.Latency.clone()
+		stats.CompletionTokensPerRequest = s.CompletionTokensPerRequest.clone()
+		stats.QueueWait = s.QueueWait.clone()
+		result = append(result, stats)
+	}
+
+	slices.SortFunc(result, func(a, b ModelStats) int {
+		return cmp.Or(cmp.Compare(a.Model, b.Model), cmp.Compare(a.Endpoint, b.Endpoint))
+	})
+
+	return result
+}
+
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.series = make(map[MetricsKey]*ModelStats)
+}
+
+// stats must be called with the mutex held
+func (m *Metrics) stats(key MetricsKey) *ModelStats {
+	s, ok := m.series[key]
+	if !ok {
+		s = &ModelStats{
+			MetricsKey:                 key,
+			Latency:                    newHistogram(DefaultLatencyBuckets),
+			CompletionTokensPerRequest: newHistogram(DefaultTokenBuckets),
+			QueueWait:                  newHistogram(DefaultQueueWaitBuckets),
+		}
+		m.series[key] = s
+	}
+
+	return s
+}
+
+// observe records a model call, frame is the final frame of the response carrying the usage, if any
+func (m *Metrics) observe(key MetricsKey, latency time.Duration, failed bool, frame *streamFrame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats(key)
+
+	s.Requests++
+	s.Latency.observe(latency.Seconds())
+
+	if failed {
+		s.Errors++
+		return
+	}
+
+	if frame == nil {
+		return
+	}
+
+	promptTokens, completionTokens := frame.PromptEvalCount, frame.EvalCount
+	if frame.Usage != nil {
+		promptTokens, completionTokens = frame.Usage.PromptTokens, frame.Usage.CompletionTokens
+	}
+
+	s.PromptTokens += int64(promptTokens)
+	s.CompletionTokens += int64(completionTokens)
+	s.LoadDuration += time.Duration(frame.LoadDuration)
+	s.TotalDuration += time.Duration(frame.TotalDuration)
+	s.CompletionTokensPerRequest.observe(float64(completionTokens))
+}
+
+func (m *Metrics) observeQueueWait(key MetricsKey, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats(key).QueueWait.observe(wait.Seconds())
+}
+
+// Handler serves the metrics in the Prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snapshot := m.Snapshot()
+	bw := bufio.NewWriter(w)
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(ModelStats) string
+	}{
+		{"llm_requests_total", "Number of model calls.", func(s ModelStats) string { return strconv.FormatInt(s.Requests, 10) }},
+		{"llm_request_errors_total", "Number of failed model calls.", func(s ModelStats) string { return strconv.FormatInt(s.Errors, 10) }},
+		{"llm_prompt_tokens_total", "Number of prompt tokens.", func(s ModelStats) string { return strconv.FormatInt(s.PromptTokens, 10) }},
+		{"llm_completion_tokens_total", "Number of completion tokens.", func(s ModelStats) string { return strconv.FormatInt(s.CompletionTokens, 10) }},
+		{"llm_load_duration_seconds_total", "Model load time reported by the server.", func(s ModelStats) string { return formatFloat(s.LoadDuration.Seconds()) }},
+		{"llm_total_duration_seconds_total", "Generation time reported by the server.", func(s ModelStats) string { return formatFloat(s.TotalDuration.Seconds()) }},
+	}
+
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, s := range snapshot {
+			fmt.Fprintf(bw, "%s{%s} %s\n", c.name, labels(s.MetricsKey), c.value(s))
+		}
+	}
+
+	histograms := []struct {
+		name  string
+		help  string
+		value func(ModelStats) Histogram
+	}{
+		{"llm_request_duration_seconds", "Latency of the model calls measured by the client.", func(s ModelStats) Histogram { return s.Latency }},
+		{"llm_completion_tokens", "Completion tokens per model call.", func(s ModelStats) Histogram { return s.CompletionTokensPerRequest }},
+		{"llm_queue_wait_seconds", "Time the model calls waited for the client-side rate limit.", func(s ModelStats) Histogram { return s.QueueWait }},
+	}
+
+	for _, h := range histograms {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+		for _, s := range snapshot {
+			writeHistogram(bw, h.name, labels(s.MetricsKey), h.value(s))
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeHistogram(w io.Writer, name string, labels string, h Histogram) {
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.Count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.Sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.Count)
+}
+
+func labels(key MetricsKey) string {
+	return fmt.Sprintf(`model="%s",endpoint="%s"`, escapeLabel(key.Model), escapeLabel(key.Endpoint))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// MetricsRoundTripper records the token usage and the latency of every model call into Metrics.
+// The usage is parsed from the Ollama and OpenAI response bodies, or from the final frame of
+// streamed responses, while the caller reads them.
+type MetricsRoundTripper struct {
+	Transport http.RoundTripper
+	metrics   *Metrics
+}
+
+// NewMetricsRoundTripper wraps the transport, a nil transport uses the same defaults as NewLoggingRoundTripper.
+func NewMetricsRoundTripper(metrics *Metrics, transport http.RoundTripper) *MetricsRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	return &MetricsRoundTripper{Transport: transport, metrics: metrics}
+}
+
+func (m *MetricsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("readRequestBody: %w", err)
+	}
+
+	key := MetricsKey{
+		Model:    cmp.Or(requestModel(body), "unknown"),
+		Endpoint: req.URL.Path,
+	}
+
+	start := time.Now()
+
+	resp, err := m.Transport.RoundTrip(req)
+	if err != nil {
+		m.metrics.observe(key, time.Since(start), true, nil)
+		return nil, err
+	}
+
+	failed := resp.StatusCode >= http.StatusBadRequest
+
+	if isStream(resp.Header) {
+		summary := &streamSummary{}
+		frames := newFrameWriter(resp.Header, summary.add)
+
+		resp.Body = newTeeBody(resp.Body, frames, func() {
+			frames.Flush()
+			m.metrics.observe(key, time.Since(start), failed || summary.final == nil, summary.final)
+		})
+		return resp, nil
+	}
+
+	var buf bytes.Buffer
+	resp.Body = newTeeBody(resp.Body, &buf, func() {
+		var frame streamFrame
+		if err := json.Unmarshal(buf.Bytes(), &frame); err != nil {
+			m.metrics.observe(key, time.Since(start), failed, nil)
+			return
+		}
+		m.metrics.observe(key, time.Since(start), failed, &frame)
+	})
+
+	return resp, nil
+}
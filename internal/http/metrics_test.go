@@ -0,0 +1,69 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRoundTripper(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = io.WriteString(w, ndjsonStream)
+	})
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"gpt-4","choices":[{"message":{"content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	metrics := NewMetrics()
+	client := &http.Client{Transport: NewMetricsRoundTripper(metrics, http.DefaultTransport)}
+
+	for _, call := range []struct{ path, body string }{
+		{"/api/chat", `{"model":"llama3.2","stream":true}`},
+		{"/api/chat", `{"model":"llama3.2","stream":true}`},
+		{"/v1/chat/completions", `{"model":"gpt-4"}`},
+	} {
+		resp, err := post(t, client, srv.URL+call.path, call.body)
+		if err != nil {
+			t.Fatalf("post: %s", err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("got %d series, want 2: %+v", len(snapshot), snapshot)
+	}
+
+	openai, ollama := snapshot[0], snapshot[1]
+
+	if ollama.Model != "llama3.2" || ollama.Requests != 2 || ollama.CompletionTokens != 4 {
+		t.Errorf("unexpected ollama stats: %+v", ollama)
+	}
+	if openai.Model != "gpt-4" || openai.Requests != 1 || openai.PromptTokens != 10 || openai.CompletionTokens != 5 {
+		t.Errorf("unexpected openai stats: %+v", openai)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, want := range []string{
+		"# TYPE llm_requests_total counter",
+		`llm_requests_total{model="llama3.2",endpoint="/api/chat"} 2`,
+		`llm_completion_tokens_total{model="gpt-4",endpoint="/v1/chat/completions"} 5`,
+		"# TYPE llm_request_duration_seconds histogram",
+		`llm_request_duration_seconds_count{model="llama3.2",endpoint="/api/chat"} 2`,
+		`llm_completion_tokens_bucket{model="llama3.2",endpoint="/api/chat",le="16"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("exposition does not contain %q:\n%s", want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the calls to a model on a host
+type RateLimit struct {
+	// RequestsPerSecond refills a token bucket of Burst tokens, 0 means no rate limit
+	RequestsPerSecond float64
+	// Burst is the number of calls which can be sent at once, 1 by default
+	Burst int
+	// MaxInFlight caps the concurrent calls, 0 means no cap.
+	// A call is in flight until its response body is read or closed, so a stream holds its slot until it ends.
+	MaxInFlight int
+}
+
+// RateLimitKey identifies the calls sharing a limit, the model is parsed from the request body
+type RateLimitKey struct {
+	Host  string
+	Model string
+}
+
+// RateLimitRoundTripper enforces a RateLimit per host and model, so parallel ingestion or evaluation runs
+// do not overwhelm a local model server or get throttled by a hosted provider.
+// The calls waiting for their turn block until the limit allows them or their context is done.
+type RateLimitRoundTripper struct {
+	Transport http.RoundTripper
+
+	limit       RateLimit
+	modelLimits map[string]RateLimit
+	metrics     *Metrics
+
+	mu       sync.Mutex
+	limiters map[RateLimitKey]*limiter
+}
+
+// RateLimitRoundTripperOption is a functional option for RateLimitRoundTripper
+type RateLimitRoundTripperOption func(*RateLimitRoundTripper)
+
+// WithModelRateLimit overrides the default limit for a model, on every host
+func WithModelRateLimit(model string, limit RateLimit) RateLimitRoundTripperOption {
+	return func(r *RateLimitRoundTripper) {
+		r.modelLimits[model] = limit
+	}
+}
+
+// WithRateLimitMetrics records how long the calls wait for their turn into the QueueWait histogram of metrics
+func WithRateLimitMetrics(metrics *Metrics) RateLimitRoundTripperOption {
+	return func(r *RateLimitRoundTripper) {
+		r.metrics = metrics
+	}
+}
+
+// NewRateLimitRoundTripper wraps the transport with the default limit of every host and model,
+// a nil transport uses the same defaults as NewLoggingRoundTripper.
+func NewRateLimitRoundTripper(limit RateLimit, transport http.RoundTripper, opts ...RateLimitRoundTripperOption) *RateLimitRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	r := &RateLimitRoundTripper{
+		Transport:   transport,
+		limit:       limit,
+		modelLimits: make(map[string]RateLimit),
+		limiters:    make(map[RateLimitKey]*limiter),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+func (r *RateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("readRequestBody: %w", err)
+	}
+
+	model := requestModel(body)
+	l := r.limiter(RateLimitKey{Host: req.URL.Host, Model: model})
+
+	start := time.Now()
+	err = l.wait(req.Context())
+	if r.metrics != nil {
+		r.metrics.observeQueueWait(MetricsKey{Model: cmp.Or(model, "unknown"), Endpoint: req.URL.Path}, time.Since(start))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("limiter.wait: %w", err)
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		l.release()
+		return resp, nil
+	}
+
+	resp.Body = newTeeBody(resp.Body, io.Discard, l.release)
+
+	return resp, nil
+}
+
+func (r *RateLimitRoundTripper) limiter(key RateLimitKey) *limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.limiters[key]
+	if !ok {
+		limit, ok := r.modelLimits[key.Model]
+		if !ok {
+			limit = r.limit
+		}
+
+		l = newLimiter(limit)
+		r.limiters[key] = l
+	}
+
+	return l
+}
+
+// limiter combines a token bucket and a semaphore
+type limiter struct {
+	rate     float64
+	burst    float64
+	inFlight chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(limit RateLimit) *limiter {
+	burst := float64(max(limit.Burst, 1))
+
+	l := &limiter{
+		rate:   limit.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+
+	if limit.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+
+	return l
+}
+
+// wait blocks until the call can be sent, it must be followed by release when it returns no error
+func (l *limiter) wait(ctx context.Context) error {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := l.take(ctx); err != nil {
+		l.release()
+		return err
+	}
+
+	return nil
+}
+
+// take reserves a token, the waiting calls are served in the order they reserved them
+func (l *limiter) take(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	if err := sleep(ctx, delay); err != nil {
+		// give the reserved token back to the next calls
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (l *limiter) release() {
+	if l.inFlight != nil {
+		<-l.inFlight
+	}
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRoundTripper_maxInFlight(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = io.WriteString(w, ndjsonStream)
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics()
+	client := &http.Client{Transport: NewRateLimitRoundTripper(RateLimit{}, http.DefaultTransport,
+		WithModelRateLimit("llama3.2", RateLimit{MaxInFlight: 2}),
+		WithRateLimitMetrics(metrics),
+	)}
+
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+			if err != nil {
+				t.Errorf("post: %s", err)
+				return
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInFlight.Load(); got != 2 {
+		t.Fatalf("max in flight is %d, want 2", got)
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].QueueWait.Count != 6 {
+		t.Fatalf("unexpected queue wait metrics: %+v", snapshot)
+	}
+	if snapshot[0].QueueWait.Sum == 0 {
+		t.Fatalf("queue wait is zero, want the calls to wait for a slot")
+	}
+}
+
+func TestRateLimitRoundTripper_rate(t *testing.T) {
+	srv := newNDJSONServer(t)
+
+	client := &http.Client{Transport: NewRateLimitRoundTripper(RateLimit{RequestsPerSecond: 20, Burst: 1}, http.DefaultTransport)}
+
+	start := time.Now()
+	for range 3 {
+		resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+		if err != nil {
+			t.Fatalf("post: %s", err)
+		}
+		_ = readAll(t, resp)
+	}
+
+	// the first call takes the burst token, the next two wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("3 calls took %s, want at least 100ms at 20 calls per second", elapsed)
+	}
+
+	// another model has its own bucket
+	start = time.Now()
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"qwen2.5"}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	_ = readAll(t, resp)
+
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Fatalf("call to another model took %s, want no wait", elapsed)
+	}
+}
+
+func TestRateLimitRoundTripper_contextDone(t *testing.T) {
+	srv := newNDJSONServer(t)
+
+	client := &http.Client{Transport: NewRateLimitRoundTripper(RateLimit{MaxInFlight: 1}, http.DefaultTransport)}
+
+	// the first body is not read, so its call stays in flight
+	first, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/api/chat", strings.NewReader(`{"model":"llama3.2"}`))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error is %v, want context.DeadlineExceeded", err)
+	}
+
+	_ = readAll(t, first)
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("post after the first call ended: %s", err)
+	}
+	_ = readAll(t, resp)
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultRedactedHeaders are the headers carrying credentials, their values are never logged.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Api-Key",
+	"X-Api-Key",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// DefaultRedactedJSONPaths are the JSON paths masked in the logged bodies:
+// the base64 images sent to Ollama vision models, which would make the logs unreadable.
+var DefaultRedactedJSONPaths = []string{
+	"messages.*.images",
+	"images",
+}
+
+// Redactor masks the sensitive or noisy parts of a body before it is logged.
+type Redactor interface {
+	Redact(body []byte) []byte
+}
+
+// RedactorFunc is an adapter to use ordinary functions as a Redactor
+type RedactorFunc func(body []byte) []byte
+
+func (f RedactorFunc) Redact(body []byte) []byte {
+	return f(body)
+}
+
+// JSONPathRedactor masks the values found at the given paths of a JSON body.
+// A path is a dot separated list of object keys, where "*" matches any key or array element,
+// e.g. "messages.*.images" masks the images of every message. Bodies which are not JSON are left as is.
+type JSONPathRedactor struct {
+	paths [][]string
+}
+
+func NewJSONPathRedactor(paths ...string) *JSONPathRedactor {
+	r := &JSONPathRedactor{}
+	for _, path := range paths {
+		r.paths = append(r.paths, strings.Split(path, "."))
+	}
+	return r
+}
+
+func (r *JSONPathRedactor) Redact(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return body
+	}
+
+	for _, path := range r.paths {
+		v = redactPath(v, path)
+	}
+
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+
+	return redacted
+}
+
+func redactPath(v any, path []string) any {
+	if len(path) == 0 {
+		return mask(v)
+	}
+
+	key, rest := path[0], path[1:]
+
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if key == "*" || k == key {
+				t[k] = redactPath(child, rest)
+			}
+		}
+	case []any:
+		if key != "*" {
+			return v
+		}
+		for i, child := range t {
+			t[i] = redactPath(child, rest)
+		}
+	}
+
+	return v
+}
+
+// mask replaces the strings with their size, so the logs still show what was sent
+func mask(v any) any {
+	switch t := v.(type) {
+	case string:
+		return fmt.Sprintf("[REDACTED %d bytes]", len(t))
+	case []any:
+		for i, child := range t {
+			t[i] = mask(child)
+		}
+		return t
+	case map[string]any:
+		for k, child := range t {
+			t[k] = mask(child)
+		}
+		return t
+	default:
+		return "[REDACTED]"
+	}
+}
+
+// redactHeaders returns a copy of the headers with the values of the given names masked
+func redactHeaders(header http.Header, names []string) http.Header {
+	redacted := header.Clone()
+	for _, name := range names {
+		if values := redacted.Values(name); len(values) > 0 {
+			redacted.Set(name, "[REDACTED]")
+		}
+	}
+	return redacted
+}
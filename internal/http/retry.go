@@ -0,0 +1,212 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryRoundTripper retries the requests failing to connect, or with 429 or 5xx status codes,
+// e.g. while Ollama is still loading the model, using exponential backoff with jitter.
+//
+// Only the response which is finally returned is handed to the caller, so a streamed body is never
+// retried once the caller started reading it. LLM calls are POST requests, their body is buffered to be
+// sent again on every attempt.
+type RetryRoundTripper struct {
+	Transport http.RoundTripper
+
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	logger      *slog.Logger
+}
+
+// RetryRoundTripperOption is a functional option for RetryRoundTripper
+type RetryRoundTripperOption func(*RetryRoundTripper)
+
+// WithMaxAttempts sets the number of attempts including the first one, 4 by default
+func WithMaxAttempts(n int) RetryRoundTripperOption {
+	return func(r *RetryRoundTripper) {
+		r.maxAttempts = max(n, 1)
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled on every attempt up to maxDelay.
+// It is 500ms up to 10s by default. A Retry-After header longer than maxDelay stops the retries.
+func WithBackoff(baseDelay, maxDelay time.Duration) RetryRoundTripperOption {
+	return func(r *RetryRoundTripper) {
+		r.baseDelay = baseDelay
+		r.maxDelay = maxDelay
+	}
+}
+
+// WithRetryLogger sets the logger of the retry attempts, slog.Default() by default
+func WithRetryLogger(logger *slog.Logger) RetryRoundTripperOption {
+	return func(r *RetryRoundTripper) {
+		r.logger = logger
+	}
+}
+
+// NewRetryRoundTripper wraps the transport, a nil transport uses the same defaults as NewLoggingRoundTripper.
+// To log every attempt, wrap a LoggingRoundTripper; to log only the final outcome, pass it to
+// NewLoggingRoundTripper with WithTransport.
+func NewRetryRoundTripper(transport http.RoundTripper, opts ...RetryRoundTripperOption) *RetryRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	r := &RetryRoundTripper{
+		Transport:   transport,
+		maxAttempts: 4,
+		baseDelay:   500 * time.Millisecond,
+		maxDelay:    10 * time.Second,
+		logger:      slog.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+func (r *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("readRequestBody: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		if body != nil {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := r.Transport.RoundTrip(attemptReq)
+
+		if attempt == r.maxAttempts || !shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := r.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(resp); ok {
+			if retryAfter > r.maxDelay {
+				return resp, err
+			}
+			delay = retryAfter
+		}
+
+		attrs := []any{
+			slog.String("url", req.URL.String()),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		} else {
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			drain(resp.Body)
+		}
+		r.logger.WarnContext(ctx, "http request retry", attrs...)
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("retry after attempt %d: %w", attempt, err)
+		}
+	}
+}
+
+// backoff returns the exponential delay for the attempt with equal jitter:
+// half of the delay is fixed and the other half is random.
+func (r *RetryRoundTripper) backoff(attempt int) time.Duration {
+	delay := r.baseDelay << (attempt - 1)
+	if delay > r.maxDelay || delay <= 0 {
+		delay = r.maxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+
+	return half + rand.N(half)
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return isConnectionError(err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode == http.StatusNotImplemented:
+		return false
+	default:
+		return resp.StatusCode >= http.StatusInternalServerError
+	}
+}
+
+// isConnectionError reports whether the request failed to connect, so it was not sent to the server.
+// A failure after the connection, e.g. an EOF or a reset while reading the response, is not retried,
+// as the server may have processed the request already: a completion would be generated and billed twice.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter reads the Retry-After header, either in seconds or as an HTTP date
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
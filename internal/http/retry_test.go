@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryRoundTripper_retriesUnavailable(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"model":"llama3.2"}` {
+			t.Errorf("attempt %d got body %q", calls.Load()+1, body)
+		}
+
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"done":true}`)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewRetryRoundTripper(nil, WithBackoff(time.Millisecond, 10*time.Millisecond))}
+
+	resp, err := post(t, client, srv.URL, `{"model":"llama3.2"}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status is %d, want 200", resp.StatusCode)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("server called %d times, want 3", calls.Load())
+	}
+}
+
+func TestRetryRoundTripper_maxAttempts(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewRetryRoundTripper(nil,
+		WithMaxAttempts(2),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	)}
+
+	resp, err := post(t, client, srv.URL, `{}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("status is %d, want 500", resp.StatusCode)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("server called %d times, want 2", calls.Load())
+	}
+}
+
+func TestRetryRoundTripper_contextCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewRetryRoundTripper(nil, WithBackoff(time.Minute, time.Minute))}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+
+	start := time.Now()
+	_, err = client.Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error is %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("returned after %s, the backoff ignored the context", elapsed)
+	}
+}
+
+func TestRetryRoundTripper_connectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	var calls atomic.Int32
+	counting := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	client := &http.Client{Transport: NewRetryRoundTripper(counting,
+		WithMaxAttempts(3),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	)}
+
+	if _, err := post(t, client, url, `{}`); err == nil {
+		t.Fatal("post succeeded on a closed server")
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("transport called %d times, want 3", calls.Load())
+	}
+}
+
+func TestRetryRoundTripper_connectionLost(t *testing.T) {
+	// the server reads the request and hangs up without a response, like a crash mid-generation
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %s", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	var calls atomic.Int32
+	counting := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	client := &http.Client{Transport: NewRetryRoundTripper(counting,
+		WithMaxAttempts(3),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	)}
+
+	if _, err := post(t, client, srv.URL, `{}`); err == nil {
+		t.Fatal("post succeeded without a response")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("transport called %d times, want 1 as the request was sent", calls.Load())
+	}
+}
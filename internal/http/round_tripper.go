@@ -2,21 +2,159 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
+// LoggingRoundTripper logs the requests and responses with log/slog.
+// Every request gets an ID, taken from the X-Request-Id header when present,
+// which is attached to all of its log records.
 type LoggingRoundTripper struct {
 	Transport http.RoundTripper
+
+	logger        *slog.Logger
+	level         slog.Level
+	redactor      Redactor
+	redactHeaders []string
+	har           *HARRecorder
+	curl          bool
+	lastID        atomic.Uint64
+}
+
+// LoggingRoundTripperOption is a functional option for LoggingRoundTripper
+type LoggingRoundTripperOption func(*loggingOptions)
+
+type loggingOptions struct {
+	transport     http.RoundTripper
+	cassette      *Cassette
+	logger        *slog.Logger
+	level         slog.Level
+	redactor      Redactor
+	redactHeaders []string
+	har           *HARRecorder
+	curl          bool
+}
+
+// WithTransport sets the underlying transport used to send requests
+func WithTransport(transport http.RoundTripper) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.transport = transport
+	}
+}
+
+// WithCassette records or replays the requests using the given cassette,
+// see NewCassette for the available modes.
+func WithCassette(cassette *Cassette) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.cassette = cassette
+	}
+}
+
+// WithLogger sets the logger, slog.Default() by default
+func WithLogger(logger *slog.Logger) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.logger = logger
+	}
+}
+
+// WithLogLevel sets the level of the request and response records, slog.LevelInfo by default.
+// Nothing is read from the bodies when the logger does not handle that level.
+func WithLogLevel(level slog.Level) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.level = level
+	}
+}
+
+// WithRedactor sets the redactor applied to the logged bodies,
+// a JSONPathRedactor of DefaultRedactedJSONPaths by default.
+func WithRedactor(redactor Redactor) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.redactor = redactor
+	}
+}
+
+// WithRedactedHeaders adds headers to DefaultRedactedHeaders
+func WithRedactedHeaders(names ...string) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.redactHeaders = append(o.redactHeaders, names...)
+	}
+}
+
+// WithHAR records every request and response to the HAR file of the recorder, independently of the log level.
+// The bodies are recorded as sent, only the headers are redacted.
+func WithHAR(recorder *HARRecorder) LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.har = recorder
+	}
+}
+
+// WithCurl adds a curl command sending the same request to every request record.
+// The command carries the exact body, the redacted headers have to be filled in before running it.
+func WithCurl() LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		o.curl = true
+	}
 }
 
-func NewLoggingRoundTripper() *LoggingRoundTripper {
-	transport := &http.Transport{
+// WithExportFromEnv enables WithHAR when the LLM_HAR_FILE environment variable is set to a path,
+// and WithCurl when LLM_CURL is set to a true value, so the examples can be replayed without changing the code.
+func WithExportFromEnv() LoggingRoundTripperOption {
+	return func(o *loggingOptions) {
+		if path := os.Getenv("LLM_HAR_FILE"); path != "" {
+			o.har = NewHARRecorder(path)
+		}
+		if curl, _ := strconv.ParseBool(os.Getenv("LLM_CURL")); curl {
+			o.curl = true
+		}
+	}
+}
+
+func NewLoggingRoundTripper(opts ...LoggingRoundTripperOption) *LoggingRoundTripper {
+	o := &loggingOptions{
+		level:         slog.LevelInfo,
+		redactor:      NewJSONPathRedactor(DefaultRedactedJSONPaths...),
+		redactHeaders: slices.Clone(DefaultRedactedHeaders),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	transport := o.transport
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	if o.cassette != nil {
+		transport = NewCassetteRoundTripper(o.cassette, transport)
+	}
+
+	logger := o.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &LoggingRoundTripper{
+		Transport:     transport,
+		logger:        logger,
+		level:         o.level,
+		redactor:      o.redactor,
+		redactHeaders: o.redactHeaders,
+		har:           o.har,
+		curl:          o.curl,
+	}
+}
+
+func newTransport() *http.Transport {
+	return &http.Transport{
 		MaxIdleConns:          100,
 		MaxIdleConnsPerHost:   10,
 		IdleConnTimeout:       90 * time.Second,
@@ -27,75 +165,213 @@ func NewLoggingRoundTripper() *LoggingRoundTripper {
 			KeepAlive: 30 * time.Second,
 		}).DialContext,
 	}
-
-	return &LoggingRoundTripper{Transport: transport}
 }
 
 func (c *LoggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	if err := logRequest(req); err != nil {
+	var resp *http.Response
+	var err error
+	if c.har != nil {
+		resp, err = c.recordHAR(req)
+	} else {
+		resp, err = c.logRoundTrip(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recordServerTimings(req.Context(), resp)
+
+	return resp, nil
+}
+
+// recordHAR adds an entry to the HAR file once the response body has been read
+func (c *LoggingRoundTripper) recordHAR(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("readRequestBody: %w", err)
+	}
+
+	start := time.Now()
+	entry := newHAREntry(req, body, c.redactHeaders, start)
+
+	resp, err := c.logRoundTrip(req)
+	if err != nil {
+		entry.setError(err)
+		entry.setTimings(start, time.Time{}, time.Now())
+		c.addHAREntry(entry)
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	received := &firstByteWriter{w: &buf}
+	resp.Body = newTeeBody(resp.Body, received, func() {
+		entry.setResponse(resp, buf.Bytes(), c.redactHeaders)
+		entry.setTimings(start, received.first, time.Now())
+		c.addHAREntry(entry)
+	})
+
+	return resp, nil
+}
+
+func (c *LoggingRoundTripper) addHAREntry(entry *HAREntry) {
+	if err := c.har.add(entry); err != nil {
+		c.logger.Error("har add", slog.String("error", err.Error()))
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (c *LoggingRoundTripper) logRoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !c.logger.Enabled(ctx, c.level) {
+		return c.Transport.RoundTrip(req)
+	}
+
+	requestID := req.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = strconv.FormatUint(c.lastID.Add(1), 10)
+	}
+	logger := c.logger.With(slog.String("request_id", requestID))
+
+	if err := c.logRequest(ctx, logger, req); err != nil {
 		return nil, fmt.Errorf("logRequest: %w", err)
 	}
 
+	start := time.Now()
+
 	resp, err := c.Transport.RoundTrip(req)
 	if err != nil {
+		logger.Log(ctx, max(c.level, slog.LevelWarn), "http request failed",
+			slog.Duration("duration", time.Since(start)),
+			slog.String("error", err.Error()))
 		return nil, fmt.Errorf("RoundTrip: %w", err)
 	}
 
-	if err := logResponse(resp); err != nil {
-		return nil, fmt.Errorf("logResponse: %w", err)
-	}
+	c.logResponse(ctx, logger, resp, time.Since(start))
 
 	return resp, nil
 }
 
-func logRequest(req *http.Request) error {
-	log.Printf("Request: %s %s", req.Method, req.URL)
+func (c *LoggingRoundTripper) logRequest(ctx context.Context, logger *slog.Logger, req *http.Request) error {
+	attrs := []any{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.String()),
+		c.headersAttr(req.Header),
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return fmt.Errorf("readRequestBody: %w", err)
+	}
+	if body != nil {
+		attrs = append(attrs, c.bodyAttr(body))
+	}
+	if c.curl {
+		attrs = append(attrs, slog.String("curl", curlCommand(req, body, c.redactHeaders)))
+	}
+
+	logger.Log(ctx, c.level, "http request", attrs...)
+
+	return nil
+}
+
+// logResponse logs the response body while the caller reads it, so streamed responses are not delayed.
+// Streamed NDJSON and SSE bodies are logged as a single message reassembled from the content fragments,
+// together with the stats of the final frame.
+func (c *LoggingRoundTripper) logResponse(ctx context.Context, logger *slog.Logger, resp *http.Response, duration time.Duration) {
+	attrs := []any{
+		slog.Int("status", resp.StatusCode),
+		slog.Duration("duration", duration),
+		c.headersAttr(resp.Header),
+	}
 
-	if req.Body == nil {
-		return nil
+	if resp.Body == nil || resp.Body == http.NoBody {
+		logger.Log(ctx, c.level, "http response", attrs...)
+		return
 	}
 
-	var err error
-	req.Body, err = logBody(req.Body, "Request Body", true)
-	return err
+	if isStream(resp.Header) {
+		logger.Log(ctx, c.level, "http response", attrs...)
+
+		summary := &streamSummary{}
+		frames := newFrameWriter(resp.Header, summary.add)
+
+		resp.Body = newTeeBody(resp.Body, frames, func() {
+			frames.Flush()
+			logger.Log(ctx, c.level, "http response stream", streamSummaryAttrs(summary)...)
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	resp.Body = newTeeBody(resp.Body, &buf, func() {
+		logger.Log(ctx, c.level, "http response", append(attrs, c.bodyAttr(buf.Bytes()))...)
+	})
 }
 
-func logResponse(resp *http.Response) error {
-	return nil
+func (c *LoggingRoundTripper) headersAttr(header http.Header) slog.Attr {
+	redacted := redactHeaders(header, c.redactHeaders)
 
-	//log.Printf("Response Status: %s", resp.Status)
-	//
-	//if resp.Body == nil {
-	//	return nil
-	//}
-	//
-	//var err error
-	//resp.Body, err = logBody(resp.Body, "Response Body", false)
-	//return err
+	names := make([]string, 0, len(redacted))
+	for name := range redacted {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	attrs := make([]any, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, slog.Any(name, redacted.Values(name)))
+	}
+
+	return slog.Group("headers", attrs...)
 }
 
-func logBody(body io.ReadCloser, logPrefix string, pretty bool) (io.ReadCloser, error) {
-	bodyBytes, err := io.ReadAll(body)
-	if err != nil {
-		return nil, fmt.Errorf("io.ReadAll: %w", err)
+// bodyAttr logs JSON bodies as raw JSON, so they are embedded as objects by slog.JSONHandler
+func (c *LoggingRoundTripper) bodyAttr(body []byte) slog.Attr {
+	if c.redactor != nil {
+		body = c.redactor.Redact(body)
 	}
 
-	printBytes := bodyBytes
-	if pretty {
-		// Final response for SSE is not valid JSON
-		// {"model":"llama3.2","created_at":"2025-03-03T12:46:54.866443Z","message":{"role":"assistant","content":"How"},"done":false}
-		// {"model":"llama3.2","created_at":"2025-03-03T12:46:54.904178Z","message":{"role":"assistant","content":" can"},"done":false}
-		// {"model":"llama3.2","created_at":"2025-03-03T12:46:55.177874Z","message":{"role":"assistant","content":""},"done_reason":"stop","done":true,"total_duration":943410791,"load_duration":48098083,"prompt_eval_count":26,"prompt_eval_duration":582000000,"eval_count":8,"eval_duration":311000000}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, body); err != nil {
+		return slog.String("body", string(body))
+	}
 
-		var prettyJSON bytes.Buffer
-		if err := json.Indent(&prettyJSON, bodyBytes, "", "  "); err != nil {
-			return nil, fmt.Errorf("json.Indent: %w", err)
-		}
-		printBytes = prettyJSON.Bytes()
+	return slog.Any("body", json.RawMessage(buf.Bytes()))
+}
+
+func streamSummaryAttrs(summary *streamSummary) []any {
+	attrs := []any{
+		slog.Int("frames", summary.frames),
+		slog.String("content", summary.content.String()),
+	}
+
+	final := summary.final
+	if final == nil {
+		return append(attrs, slog.Bool("incomplete", true))
 	}
 
-	log.Printf("%s: %s", logPrefix, string(printBytes))
+	attrs = append(attrs,
+		slog.String("model", final.Model),
+		slog.String("stop_reason", final.stopReason()),
+	)
+
+	if final.Usage != nil {
+		return append(attrs, slog.Group("usage",
+			slog.Int("prompt_tokens", final.Usage.PromptTokens),
+			slog.Int("completion_tokens", final.Usage.CompletionTokens),
+			slog.Int("total_tokens", final.Usage.TotalTokens),
+		))
+	}
 
-	// Reset the body so it can be read again
-	return io.NopCloser(bytes.NewBuffer(bodyBytes)), nil
+	return append(attrs, slog.Group("stats",
+		slog.Int("prompt_eval_count", final.PromptEvalCount),
+		slog.Int("eval_count", final.EvalCount),
+		slog.Duration("total_duration", time.Duration(final.TotalDuration)),
+		slog.Duration("load_duration", time.Duration(final.LoadDuration)),
+		slog.Duration("prompt_eval_duration", time.Duration(final.PromptEvalDuration)),
+		slog.Duration("eval_duration", time.Duration(final.EvalDuration)),
+	))
 }
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewTextHandler(&buf, nil)), &buf
+}
+
+func TestLoggingRoundTripper_streamedResponse(t *testing.T) {
+	logger, logs := newTestLogger()
+
+	frames := strings.SplitAfter(ndjsonStream, "\n")
+	firstRead := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = io.WriteString(w, frames[0])
+		w.(http.Flusher).Flush()
+
+		// the rest of the stream is only sent once the client got the first frame
+		select {
+		case <-firstRead:
+		case <-time.After(5 * time.Second):
+			return
+		}
+
+		for _, frame := range frames[1:] {
+			_, _ = io.WriteString(w, frame)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewLoggingRoundTripper(WithLogger(logger))}
+
+	resp, err := post(t, client, srv.URL+"/api/chat", `{"model":"llama3.2","stream":true}`)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	if !scanner.Scan() {
+		t.Fatalf("first frame not received: %v", scanner.Err())
+	}
+	close(firstRead)
+
+	for scanner.Scan() {
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanner.Err: %s", err)
+	}
+
+	for _, want := range []string{
+		`msg="http response stream" request_id=1 frames=3 content="Hello there"`,
+		"stop_reason=stop",
+		"stats.eval_count=2",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs do not contain %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestLoggingRoundTripper_redaction(t *testing.T) {
+	logger, logs := newTestLogger()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"done":true}`)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewLoggingRoundTripper(WithLogger(logger), WithRedactedHeaders("X-Secret"))}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, srv.URL+"/api/chat",
+		strings.NewReader(`{"model":"moondream","messages":[{"role":"user","content":"What is in the image?","images":["aGVsbG8gd29ybGQ="]}]}`))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	req.Header.Set("X-Secret", "top-secret")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do: %s", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	for _, secret := range []string{"sk-secret", "top-secret", "aGVsbG8gd29ybGQ="} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("logs contain %q:\n%s", secret, logs)
+		}
+	}
+
+	for _, want := range []string{
+		"headers.Authorization=[[REDACTED]]",
+		"[REDACTED 16 bytes]",
+		"What is in the image?",
+		`msg="http response" request_id=1 status=200`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs do not contain %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestLoggingRoundTripper_serverTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"llama3.2","done":true,"load_duration":48000000,"prompt_eval_duration":582000000,"eval_duration":311000000}`)
+	}))
+	defer srv.Close()
+
+	// the timings are recorded even when nothing is logged
+	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))
+	client := &http.Client{Transport: NewLoggingRoundTripper(WithLogger(logger))}
+
+	var timings ServerTimings
+	req, err := http.NewRequestWithContext(WithServerTimings(t.Context(), &timings), http.MethodPost, srv.URL+"/api/chat", strings.NewReader(`{"model":"llama3.2"}`))
+	if err != nil {
+		t.Fatalf("http.NewRequest: %s", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do: %s", err)
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Fatalf("io.Copy: %s", err)
+	}
+	resp.Body.Close()
+
+	want := ServerTimings{LoadDuration: 48 * time.Millisecond, PromptEvalDuration: 582 * time.Millisecond, EvalDuration: 311 * time.Millisecond}
+	if timings != want {
+		t.Fatalf("timings are %+v, want %+v", timings, want)
+	}
+}
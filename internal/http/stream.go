@@ -0,0 +1,266 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// isStream reports whether the body is a stream of NDJSON frames or Server-Sent Events.
+func isStream(header http.Header) bool {
+	return isNDJSON(header) || isSSE(header)
+}
+
+func isNDJSON(header http.Header) bool {
+	return mediaType(header) == "application/x-ndjson"
+}
+
+func isSSE(header http.Header) bool {
+	return mediaType(header) == "text/event-stream"
+}
+
+func mediaType(header http.Header) string {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// streamFrame is a single frame of a streamed response, it covers both the Ollama NDJSON frames:
+//
+//	{"model":"llama3.2","message":{"role":"assistant","content":"How"},"done":false}
+//	{"model":"llama3.2","message":{"role":"assistant","content":""},"done_reason":"stop","done":true,"total_duration":943410791,"load_duration":48098083,"prompt_eval_count":26,"prompt_eval_duration":582000000,"eval_count":8,"eval_duration":311000000}
+//
+// and the OpenAI Server-Sent Events chunks:
+//
+//	data: {"model":"gpt-4","choices":[{"delta":{"content":"How"},"finish_reason":null}]}
+type streamFrame struct {
+	Model string `json:"model"`
+	Error string `json:"error"`
+
+	// Ollama /api/chat and /api/generate
+	Message *struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Response           string `json:"response"`
+	Done               bool   `json:"done"`
+	DoneReason         string `json:"done_reason"`
+	TotalDuration      int64  `json:"total_duration"`
+	LoadDuration       int64  `json:"load_duration"`
+	PromptEvalCount    int    `json:"prompt_eval_count"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration"`
+	EvalCount          int    `json:"eval_count"`
+	EvalDuration       int64  `json:"eval_duration"`
+
+	// OpenAI chat completions
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// content returns the text fragment carried by the frame
+func (f *streamFrame) content() string {
+	if f.Message != nil {
+		return f.Message.Content
+	}
+	if f.Response != "" {
+		return f.Response
+	}
+
+	var sb strings.Builder
+	for _, c := range f.Choices {
+		sb.WriteString(c.Delta.Content)
+	}
+	return sb.String()
+}
+
+// final reports whether the frame carries the stop reason and the usage stats
+func (f *streamFrame) final() bool {
+	if f.Done || f.Usage != nil {
+		return true
+	}
+
+	for _, c := range f.Choices {
+		if c.FinishReason != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *streamFrame) stopReason() string {
+	if f.DoneReason != "" {
+		return f.DoneReason
+	}
+
+	for _, c := range f.Choices {
+		if c.FinishReason != "" {
+			return c.FinishReason
+		}
+	}
+	return ""
+}
+
+// frameWriter splits the bytes written to it into lines and calls onFrame with the JSON payload
+// of every NDJSON line or SSE "data:" line. Only the current incomplete line is buffered.
+type frameWriter struct {
+	sse     bool
+	partial []byte
+	onFrame func([]byte)
+}
+
+func newFrameWriter(header http.Header, onFrame func([]byte)) *frameWriter {
+	return &frameWriter{sse: isSSE(header), onFrame: onFrame}
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			w.partial = append(w.partial, data...)
+			return len(p), nil
+		}
+
+		w.partial = append(w.partial, data[:i]...)
+		w.line(w.partial)
+		w.partial = w.partial[:0]
+		data = data[i+1:]
+	}
+}
+
+// Flush handles the last line of a body which does not end with a newline
+func (w *frameWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.line(w.partial)
+		w.partial = w.partial[:0]
+	}
+}
+
+func (w *frameWriter) line(line []byte) {
+	line = bytes.TrimSpace(line)
+
+	if w.sse {
+		payload, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			return
+		}
+		line = bytes.TrimSpace(payload)
+		if string(line) == "[DONE]" {
+			return
+		}
+	}
+
+	if len(line) > 0 {
+		w.onFrame(line)
+	}
+}
+
+// streamSummary reassembles the content fragments of a streamed response and keeps its final frame
+type streamSummary struct {
+	frames  int
+	content strings.Builder
+	final   *streamFrame
+}
+
+func (s *streamSummary) add(data []byte) {
+	var frame streamFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return
+	}
+
+	s.frames++
+	s.content.WriteString(frame.content())
+
+	if frame.final() {
+		s.final = &frame
+	}
+}
+
+// teeBody writes everything read from the body to w as the caller reads it, so streamed responses
+// keep being delivered chunk by chunk. onDone is called once the body is fully read or closed.
+type teeBody struct {
+	body   io.ReadCloser
+	w      io.Writer
+	onDone func()
+	once   sync.Once
+}
+
+func newTeeBody(body io.ReadCloser, w io.Writer, onDone func()) *teeBody {
+	return &teeBody{body: body, w: w, onDone: onDone}
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 {
+		_, _ = t.w.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		t.done()
+	}
+
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	err := t.body.Close()
+	t.done()
+	return err
+}
+
+func (t *teeBody) done() {
+	t.once.Do(t.onDone)
+}
+
+// ServerTimings are the durations Ollama reports in the final frame of a response,
+// which the langchaingo backend does not return
+type ServerTimings struct {
+	LoadDuration       time.Duration
+	PromptEvalDuration time.Duration
+	EvalDuration       time.Duration
+}
+
+type serverTimingsKey struct{}
+
+// WithServerTimings returns a context whose responses add their durations to timings once their body
+// is read, when a LoggingRoundTripper is in the transport chain. It records one call at a time.
+func WithServerTimings(ctx context.Context, timings *ServerTimings) context.Context {
+	return context.WithValue(ctx, serverTimingsKey{}, timings)
+}
+
+// recordServerTimings parses the body of the response while the caller reads it, streamed or not,
+// and adds the durations of its final frame to the timings of the request context
+func recordServerTimings(ctx context.Context, resp *http.Response) {
+	timings, _ := ctx.Value(serverTimingsKey{}).(*ServerTimings)
+	if timings == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+
+	summary := &streamSummary{}
+	frames := newFrameWriter(resp.Header, summary.add)
+
+	resp.Body = newTeeBody(resp.Body, frames, func() {
+		frames.Flush()
+		if final := summary.final; final != nil {
+			timings.LoadDuration += time.Duration(final.LoadDuration)
+			timings.PromptEvalDuration += time.Duration(final.PromptEvalDuration)
+			timings.EvalDuration += time.Duration(final.EvalDuration)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/nikolayk812/genai-go/internal/http"
+
+// TracingRoundTripper creates a client span for every model call, with the attributes of the
+// OpenTelemetry GenAI semantic conventions. The span ends once the response body is fully read,
+// so it covers the whole generation of streamed responses.
+type TracingRoundTripper struct {
+	Transport http.RoundTripper
+	tracer    trace.Tracer
+}
+
+// TracingRoundTripperOption is a functional option for TracingRoundTripper
+type TracingRoundTripperOption func(*tracingOptions)
+
+type tracingOptions struct {
+	provider trace.TracerProvider
+}
+
+// WithTracerProvider sets the tracer provider, otel.GetTracerProvider() by default
+func WithTracerProvider(provider trace.TracerProvider) TracingRoundTripperOption {
+	return func(o *tracingOptions) {
+		o.provider = provider
+	}
+}
+
+// NewTracingRoundTripper wraps the transport, a nil transport uses the same defaults as NewLoggingRoundTripper.
+func NewTracingRoundTripper(transport http.RoundTripper, opts ...TracingRoundTripperOption) *TracingRoundTripper {
+	if transport == nil {
+		transport = newTransport()
+	}
+
+	o := &tracingOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	provider := o.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return &TracingRoundTripper{
+		Transport: transport,
+		tracer:    provider.Tracer(instrumentationName),
+	}
+}
+
+func (t *TracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("readRequestBody: %w", err)
+	}
+
+	operation := genAIOperation(req.URL.Path)
+	attrs := append([]attribute.KeyValue{
+		attribute.String("gen_ai.operation.name", operation),
+		attribute.String("gen_ai.system", genAISystem(req.URL.Path)),
+		attribute.String("server.address", req.URL.Hostname()),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.full", req.URL.String()),
+	}, genAIRequestAttributes(body)...)
+
+	spanName := operation
+	if model := requestModel(body); model != "" {
+		spanName += " " + model
+	}
+
+	ctx, span := t.tracer.Start(req.Context(), spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+
+	resp, err := t.Transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	if isStream(resp.Header) {
+		summary := &streamSummary{}
+		frames := newFrameWriter(resp.Header, summary.add)
+
+		resp.Body = newTeeBody(resp.Body, frames, func() {
+			frames.Flush()
+			endGenAISpan(span, summary.final)
+		})
+		return resp, nil
+	}
+
+	var buf bytes.Buffer
+	resp.Body = newTeeBody(resp.Body, &buf, func() {
+		var frame streamFrame
+		if err := json.Unmarshal(buf.Bytes(), &frame); err != nil {
+			endGenAISpan(span, nil)
+			return
+		}
+		endGenAISpan(span, &frame)
+	})
+
+	return resp, nil
+}
+
+func endGenAISpan(span trace.Span, final *streamFrame) {
+	defer span.End()
+
+	if final == nil {
+		return
+	}
+
+	if final.Model != "" {
+		span.SetAttributes(attribute.String("gen_ai.response.model", final.Model))
+	}
+	if reason := final.stopReason(); reason != "" {
+		span.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{reason}))
+	}
+
+	inputTokens, outputTokens := final.PromptEvalCount, final.EvalCount
+	if final.Usage != nil {
+		inputTokens, outputTokens = final.Usage.PromptTokens, final.Usage.CompletionTokens
+	}
+	if inputTokens > 0 || outputTokens > 0 {
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", inputTokens),
+			attribute.Int("gen_ai.usage.output_tokens", outputTokens),
+		)
+	}
+}
+
+// genAIOperation maps the Ollama and OpenAI endpoints to the GenAI operation names
+func genAIOperation(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/chat"), strings.HasSuffix(path, "/chat/completions"):
+		return "chat"
+	case strings.HasSuffix(path, "/generate"), strings.HasSuffix(path, "/completions"):
+		return "text_completion"
+	case strings.Contains(path, "embed"):
+		return "embeddings"
+	default:
+		return path
+	}
+}
+
+func genAISystem(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/"):
+		return "ollama"
+	case strings.HasPrefix(path, "/v1/"):
+		return "openai"
+	default:
+		return "unknown"
+	}
+}
+
+// genAIRequest covers the sampling parameters of the Ollama requests, nested in "options",
+// and of the OpenAI requests, at the top level.
+type genAIRequest struct {
+	samplingParameters
+	Options *samplingParameters `json:"options"`
+}
+
+type samplingParameters struct {
+	Temperature *float64 `json:"temperature"`
+	TopK        *int     `json:"top_k"`
+	TopP        *float64 `json:"top_p"`
+	Seed        *int     `json:"seed"`
+	MaxTokens   *int     `json:"max_tokens"`
+	NumPredict  *int     `json:"num_predict"`
+}
+
+func genAIRequestAttributes(body []byte) []attribute.KeyValue {
+	var req genAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+
+	params := req.samplingParameters
+	if req.Options != nil {
+		params = *req.Options
+	}
+
+	var attrs []attribute.KeyValue
+	if model := requestModel(body); model != "" {
+		attrs = append(attrs, attribute.String("gen_ai.request.model", model))
+	}
+	if params.Temperature != nil {
+		attrs = append(attrs, attribute.Float64("gen_ai.request.temperature", *params.Temperature))
+	}
+	if params.TopK != nil {
+		attrs = append(attrs, attribute.Int("gen_ai.request.top_k", *params.TopK))
+	}
+	if params.TopP != nil {
+		attrs = append(attrs, attribute.Float64("gen_ai.request.top_p", *params.TopP))
+	}
+	if params.Seed != nil {
+		attrs = append(attrs, attribute.Int("gen_ai.request.seed", *params.Seed))
+	}
+	if params.MaxTokens != nil {
+		attrs = append(attrs, attribute.Int("gen_ai.request.max_tokens", *params.MaxTokens))
+	} else if params.NumPredict != nil {
+		attrs = append(attrs, attribute.Int("gen_ai.request.max_tokens", *params.NumPredict))
+	}
+
+	return attrs
+}
@@ -20,23 +20,3 @@ func ContentResponseToStrings(response *lc.ContentResponse) []string {
 
 	return result
 }
-
-func TotalTokens(response *lc.ContentResponse) int {
-	if response == nil {
-		return 0
-	}
-
-	result := 0
-
-	for _, choice := range response.Choices {
-		if choice == nil {
-			continue
-		}
-
-		if totalTokens, ok := choice.GenerationInfo["TotalTokens"].(int); ok {
-			result += totalTokens
-		}
-	}
-
-	return result
-}
@@ -0,0 +1,326 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/embeddings"
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// ErrUnpriced is returned by a Budget for a model missing from its pricing, rather than counting it as free
+var ErrUnpriced = errors.New("model is not priced")
+
+// Price is the price of a model in USD per 1K tokens
+type Price struct {
+	InputPer1K  float64
+	OutputPer1K float64
+	// CachedInputPer1K is the price of the prompt tokens served from the provider cache, InputPer1K when 0
+	CachedInputPer1K float64
+}
+
+// Pricing maps the model names to their prices. A model is priced by its exact name, or else by its name
+// without the date, so "gpt-4o" also prices "gpt-4o-2024-08-06". The other models are not priced.
+type Pricing map[string]Price
+
+// DefaultPricing are the list prices of the OpenAI models used by the examples. The local models are free,
+// see WithFallbackPrice. Check the provider pricing page before relying on them.
+var DefaultPricing = Pricing{
+	"gpt-4":                  {InputPer1K: 0.03, OutputPer1K: 0.06},
+	"gpt-4-turbo":            {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4o":                 {InputPer1K: 0.0025, OutputPer1K: 0.01, CachedInputPer1K: 0.00125},
+	"gpt-4o-mini":            {InputPer1K: 0.00015, OutputPer1K: 0.0006, CachedInputPer1K: 0.000075},
+	"text-embedding-3-small": {InputPer1K: 0.00002},
+}
+
+// Price returns the price of the model, false when it is not in the table
+func (p Pricing) Price(model string) (Price, bool) {
+	return lookupModel(p, model)
+}
+
+// lookupModel returns the value of the exact model name, or else of the longest name followed in the model
+// by a date or a tag, e.g. "gpt-4o-2024-08-06", "gpt-4-0613" or "llama3.2:1b". Another suffix makes
+// another model, e.g. "gpt-4-turbo" or "gpt-4.1" are not "gpt-4", so they are not found instead of mispriced.
+func lookupModel[V any](table map[string]V, model string) (V, bool) {
+	if v, ok := table[model]; ok {
+		return v, true
+	}
+
+	var best string
+	for name := range table {
+		if rest, ok := strings.CutPrefix(model, name); ok && isVersionSuffix(rest) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		var zero V
+		return zero, false
+	}
+
+	return table[best], true
+}
+
+// isVersionSuffix reports whether the rest of a model name is an Ollama tag or starts with a date,
+// at least 4 digits after a dash
+func isVersionSuffix(rest string) bool {
+	if strings.HasPrefix(rest, ":") {
+		return true
+	}
+
+	digits, ok := strings.CutPrefix(rest, "-")
+	if !ok || len(digits) < 4 {
+		return false
+	}
+	for _, r := range digits[:4] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cost returns the cost of the usage in USD, false when the model is not in the table
+func (p Pricing) Cost(model string, usage Usage) (float64, bool) {
+	price, ok := p.Price(model)
+	if !ok {
+		return 0, false
+	}
+
+	return price.Cost(usage), true
+}
+
+// Cost returns the cost of the usage in USD
+func (p Price) Cost(usage Usage) float64 {
+	cachedPrice := p.CachedInputPer1K
+	if cachedPrice == 0 {
+		cachedPrice = p.InputPer1K
+	}
+
+	cached := min(usage.CachedTokens, usage.PromptTokens)
+	cost := float64(usage.PromptTokens-cached)*p.InputPer1K +
+		float64(cached)*cachedPrice +
+		float64(usage.CompletionTokens)*p.OutputPer1K
+
+	return cost / 1000
+}
+
+// BudgetExceededError is returned by the BudgetModel once the spend reached the limit of its Budget
+type BudgetExceededError struct {
+	Limit float64
+	Spent float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("budget exceeded: spent $%.4f of $%.4f", e.Spent, e.Limit)
+}
+
+// Budget accumulates the spend of a session, e.g. a test or a chat, per model.
+// The models missing from the pricing are refused with ErrUnpriced, unless WithFallbackPrice is set.
+// It is safe for concurrent use.
+type Budget struct {
+	limit    float64
+	pricing  Pricing
+	fallback *Price
+
+	mu    sync.Mutex
+	spent map[string]float64
+	usage map[string]Usage
+}
+
+// BudgetOption is a functional option for Budget
+type BudgetOption func(*Budget)
+
+// WithFallbackPrice prices the models missing from the pricing, e.g. Price{} to count the local models as free
+func WithFallbackPrice(price Price) BudgetOption {
+	return func(b *Budget) {
+		b.fallback = &price
+	}
+}
+
+// NewBudget creates a budget of limit USD, a limit of 0 only tracks the spend
+func NewBudget(limit float64, pricing Pricing, opts ...BudgetOption) *Budget {
+	b := &Budget{
+		limit:   limit,
+		pricing: pricing,
+		spent:   make(map[string]float64),
+		usage:   make(map[string]Usage),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Price returns the price of the model, or the fallback price, or else ErrUnpriced
+func (b *Budget) Price(model string) (Price, error) {
+	if price, ok := b.pricing.Price(model); ok {
+		return price, nil
+	}
+	if b.fallback != nil {
+		return *b.fallback, nil
+	}
+	return Price{}, fmt.Errorf("%w: %s", ErrUnpriced, model)
+}
+
+// Add records the usage of a model call and returns its cost, a model without a price is not recorded
+func (b *Budget) Add(model string, usage Usage) (float64, error) {
+	price, err := b.Price(model)
+	if err != nil {
+		return 0, err
+	}
+	cost := price.Cost(usage)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.spent[model] += cost
+	b.usage[model] = b.usage[model].Add(usage)
+
+	return cost, nil
+}
+
+// Spent returns the total spend in USD
+func (b *Budget) Spent() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.total()
+}
+
+// SpentByModel returns the spend in USD per model
+func (b *Budget) SpentByModel() map[string]float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return maps.Clone(b.spent)
+}
+
+// Usage returns the accumulated usage of a model
+func (b *Budget) Usage(model string) Usage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.usage[model]
+}
+
+// Check returns a BudgetExceededError once the spend reached the limit
+func (b *Budget) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit <= 0 {
+		return nil
+	}
+
+	if spent := b.total(); spent >= b.limit {
+		return &BudgetExceededError{Limit: b.limit, Spent: spent}
+	}
+
+	return nil
+}
+
+// total must be called with the mutex held
+func (b *Budget) total() float64 {
+	var total float64
+	for _, cost := range b.spent {
+		total += cost
+	}
+	return total
+}
+
+// BudgetModel wraps a llms.Model to record the cost of every call into a Budget,
+// and to refuse the calls once the budget is exceeded or for a model without a price.
+// The call crossing the limit still completes, as its cost is only known from its response.
+type BudgetModel struct {
+	model  lc.Model
+	name   string
+	budget *Budget
+}
+
+var _ lc.Model = (*BudgetModel)(nil)
+
+// NewBudgetModel wraps the model, name is used for the pricing unless the call sets llms.WithModel
+func NewBudgetModel(model lc.Model, name string, budget *Budget) *BudgetModel {
+	return &BudgetModel{model: model, name: name, budget: budget}
+}
+
+func (m *BudgetModel) GenerateContent(ctx context.Context, messages []lc.MessageContent, options ...lc.CallOption) (*lc.ContentResponse, error) {
+	if err := m.budget.Check(); err != nil {
+		return nil, err
+	}
+
+	opts := lc.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	name := m.name
+	if opts.Model != "" {
+		name = opts.Model
+	}
+
+	if _, err := m.budget.Price(name); err != nil {
+		return nil, err
+	}
+
+	resp, err := m.model.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.budget.Add(name, ResponseUsage(resp)); err != nil {
+		return nil, fmt.Errorf("budget.Add: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (m *BudgetModel) Call(ctx context.Context, prompt string, options ...lc.CallOption) (string, error) {
+	return lc.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// BudgetEmbedder wraps an embeddings.EmbedderClient like BudgetModel wraps a llms.Model.
+// The embedding clients of langchaingo do not report the usage, so the tokens of the texts
+// are counted with a TokenCounter of the model.
+type BudgetEmbedder struct {
+	client  embeddings.EmbedderClient
+	name    string
+	budget  *Budget
+	counter *TokenCounter
+}
+
+var _ embeddings.EmbedderClient = (*BudgetEmbedder)(nil)
+
+// NewBudgetEmbedder wraps the embedding client of the model name
+func NewBudgetEmbedder(client embeddings.EmbedderClient, name string, budget *Budget) *BudgetEmbedder {
+	return &BudgetEmbedder{client: client, name: name, budget: budget, counter: NewTokenCounter(name)}
+}
+
+func (e *BudgetEmbedder) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := e.budget.Check(); err != nil {
+		return nil, err
+	}
+	if _, err := e.budget.Price(e.name); err != nil {
+		return nil, err
+	}
+
+	vectors, err := e.client.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens int
+	for _, text := range texts {
+		tokens += e.counter.CountTokens(text)
+	}
+
+	if _, err := e.budget.Add(e.name, Usage{PromptTokens: tokens, TotalTokens: tokens}); err != nil {
+		return nil, fmt.Errorf("budget.Add: %w", err)
+	}
+
+	return vectors, nil
+}
@@ -0,0 +1,172 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// embedClient returns a vector of 3 dimensions per text
+type embedClient struct {
+	calls int
+}
+
+func (c *embedClient) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	c.calls++
+	vectors := make([][]float32, len(texts))
+	for i := range vectors {
+		vectors[i] = []float32{1, 0, 0}
+	}
+	return vectors, nil
+}
+
+type usageModel struct {
+	calls int
+	info  map[string]any
+}
+
+func (m *usageModel) GenerateContent(ctx context.Context, messages []lc.MessageContent, options ...lc.CallOption) (*lc.ContentResponse, error) {
+	m.calls++
+	return &lc.ContentResponse{Choices: []*lc.ContentChoice{{Content: "ok", GenerationInfo: m.info}}}, nil
+}
+
+func (m *usageModel) Call(ctx context.Context, prompt string, options ...lc.CallOption) (string, error) {
+	return lc.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestPricing_Cost(t *testing.T) {
+	pricing := Pricing{
+		"gpt-4o": {InputPer1K: 0.0025, OutputPer1K: 0.01, CachedInputPer1K: 0.00125},
+	}
+
+	// a dated version is priced as its family
+	cost, ok := pricing.Cost("gpt-4o-2024-08-06", Usage{PromptTokens: 2000, CachedTokens: 1000, CompletionTokens: 500})
+	if !ok {
+		t.Fatalf("gpt-4o-2024-08-06 is not priced")
+	}
+
+	want := 0.0025 + 0.00125 + 0.005
+	if math.Abs(cost-want) > 1e-9 {
+		t.Fatalf("cost is %f, want %f", cost, want)
+	}
+
+	if _, ok := pricing.Cost("llama3.2", Usage{PromptTokens: 1000}); ok {
+		t.Fatalf("llama3.2 is priced, want no price")
+	}
+}
+
+func TestPricing_Price(t *testing.T) {
+	tests := []struct {
+		model string
+		want  float64
+		ok    bool
+	}{
+		{model: "gpt-4", want: 0.03, ok: true},
+		{model: "gpt-4-0613", want: 0.03, ok: true},
+		{model: "gpt-4o-mini-2024-07-18", want: 0.00015, ok: true},
+		{model: "gpt-4-turbo", want: 0.01, ok: true},
+		{model: "gpt-4-turbo-2024-04-09", want: 0.01, ok: true},
+		{model: "text-embedding-3-small", want: 0.00002, ok: true},
+		// other models of the family are not priced as gpt-4
+		{model: "gpt-4.1"},
+		{model: "gpt-4.1-mini"},
+		{model: "gpt-4o-audio-preview"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, ok := DefaultPricing.Price(tt.model)
+			if ok != tt.ok || price.InputPer1K != tt.want {
+				t.Fatalf("price is %v, %t, want %v, %t", price.InputPer1K, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBudgetModel(t *testing.T) {
+	pricing := Pricing{"gpt-4": {InputPer1K: 0.03, OutputPer1K: 0.06}}
+	budget := NewBudget(0.1, pricing)
+
+	// every call costs 1000 * 0.03 / 1000 + 500 * 0.06 / 1000 = $0.06
+	inner := &usageModel{info: map[string]any{"PromptTokens": 1000, "CompletionTokens": 500, "TotalTokens": 1500}}
+	model := NewBudgetModel(inner, "gpt-4", budget)
+
+	for range 2 {
+		if _, err := model.Call(t.Context(), "Hello"); err != nil {
+			t.Fatalf("Call: %s", err)
+		}
+	}
+
+	_, err := model.Call(t.Context(), "Hello")
+
+	var exceeded *BudgetExceededError
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("error is %v, want a BudgetExceededError", err)
+	}
+	if math.Abs(exceeded.Spent-0.12) > 1e-9 || exceeded.Limit != 0.1 {
+		t.Fatalf("unexpected error: %+v", exceeded)
+	}
+	if inner.calls != 2 {
+		t.Fatalf("model called %d times, want 2", inner.calls)
+	}
+
+	if usage := budget.Usage("gpt-4"); usage.TotalTokens != 3000 {
+		t.Fatalf("usage is %+v, want 3000 total tokens", usage)
+	}
+}
+
+func TestBudgetModel_unpriced(t *testing.T) {
+	inner := &usageModel{info: map[string]any{"PromptTokens": 1000, "CompletionTokens": 500, "TotalTokens": 1500}}
+
+	// a model missing from the pricing is refused, not counted as free
+	model := NewBudgetModel(inner, "llama3.2", NewBudget(0.1, DefaultPricing))
+	if _, err := model.Call(t.Context(), "Hello"); !errors.Is(err, ErrUnpriced) {
+		t.Fatalf("error is %v, want ErrUnpriced", err)
+	}
+	if inner.calls != 0 {
+		t.Fatalf("model called %d times, want 0", inner.calls)
+	}
+
+	budget := NewBudget(0.1, DefaultPricing, WithFallbackPrice(Price{}))
+	model = NewBudgetModel(inner, "llama3.2", budget)
+	if _, err := model.Call(t.Context(), "Hello"); err != nil {
+		t.Fatalf("Call: %s", err)
+	}
+	if budget.Spent() != 0 || budget.Usage("llama3.2").TotalTokens != 1500 {
+		t.Fatalf("unexpected spend $%f, usage %+v", budget.Spent(), budget.Usage("llama3.2"))
+	}
+}
+
+func TestBudgetEmbedder(t *testing.T) {
+	// the texts are approximated as 4 characters per token
+	budget := NewBudget(0.1, Pricing{"embed": {InputPer1K: 2}})
+	inner := &embedClient{}
+	embedder := NewBudgetEmbedder(inner, "embed", budget)
+
+	vectors, err := embedder.CreateEmbedding(t.Context(), []string{"12345678", "1234"})
+	if err != nil || len(vectors) != 2 {
+		t.Fatalf("CreateEmbedding: %d vectors, %v", len(vectors), err)
+	}
+
+	if usage := budget.Usage("embed"); usage.PromptTokens != 3 || math.Abs(budget.Spent()-0.006) > 1e-9 {
+		t.Fatalf("unexpected spend $%f, usage %+v", budget.Spent(), usage)
+	}
+
+	// 17 calls of 3 tokens cost $0.102
+	for range 16 {
+		if _, err := embedder.CreateEmbedding(t.Context(), []string{"12345678", "1234"}); err != nil {
+			t.Fatalf("CreateEmbedding: %s", err)
+		}
+	}
+
+	var exceeded *BudgetExceededError
+	if _, err := embedder.CreateEmbedding(t.Context(), []string{"1234"}); !errors.As(err, &exceeded) {
+		t.Fatalf("error is %v, want a BudgetExceededError", err)
+	}
+	if inner.calls != 17 {
+		t.Fatalf("client called %d times, want 17", inner.calls)
+	}
+}
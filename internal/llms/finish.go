@@ -0,0 +1,221 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// FinishReason is the provider-agnostic reason of a model to stop generating
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"
+	FinishLength        FinishReason = "length"
+	FinishToolCall      FinishReason = "tool_call"
+	FinishContentFilter FinishReason = "content_filter"
+	FinishCancelled     FinishReason = "cancelled"
+	FinishUnknown       FinishReason = "unknown"
+)
+
+// stopReasons maps the stop reasons of the providers, lower-cased and without separators, e.g.
+// OpenAI "length", Anthropic "max_tokens", Google AI "FinishReasonMaxTokens" and Ollama "done_reason" values
+var stopReasons = map[string]FinishReason{
+	"stop":              FinishStop,
+	"endturn":           FinishStop,
+	"stopsequence":      FinishStop,
+	"eos":               FinishStop,
+	"length":            FinishLength,
+	"maxtokens":         FinishLength,
+	"maxoutputtokens":   FinishLength,
+	"modellength":       FinishLength,
+	"toolcalls":         FinishToolCall,
+	"toolcall":          FinishToolCall,
+	"tooluse":           FinishToolCall,
+	"functioncall":      FinishToolCall,
+	"contentfilter":     FinishContentFilter,
+	"safety":            FinishContentFilter,
+	"recitation":        FinishContentFilter,
+	"blocklist":         FinishContentFilter,
+	"prohibitedcontent": FinishContentFilter,
+	"spii":              FinishContentFilter,
+	"refusal":           FinishContentFilter,
+	"cancelled":         FinishCancelled,
+	"canceled":          FinishCancelled,
+	"abort":             FinishCancelled,
+	"aborted":           FinishCancelled,
+}
+
+// NormalizeStopReason maps the raw stop reason of a provider, e.g. llms.ContentChoice.StopReason,
+// to a FinishReason. The empty and unrecognized reasons are FinishUnknown.
+func NormalizeStopReason(raw string) FinishReason {
+	key := strings.ToLower(raw)
+	key = strings.TrimPrefix(key, "finish_reason_")
+	key = strings.TrimPrefix(key, "finishreason")
+	key = strings.NewReplacer("_", "", "-", "", " ", "").Replace(key)
+
+	if reason, ok := stopReasons[key]; ok {
+		return reason
+	}
+	return FinishUnknown
+}
+
+// ChoiceFinishReason returns the finish reason of a choice. Ollama does not report a stop reason through
+// langchaingo, so when it is unknown the reason is inferred: a choice with tool calls is FinishToolCall,
+// and a choice which used all of maxTokens, the llms.WithMaxTokens of the call, is FinishLength.
+func ChoiceFinishReason(choice *lc.ContentChoice, maxTokens int) FinishReason {
+	if choice == nil {
+		return FinishUnknown
+	}
+
+	if reason := NormalizeStopReason(choice.StopReason); reason != FinishUnknown {
+		return reason
+	}
+
+	if len(choice.ToolCalls) > 0 || choice.FuncCall != nil {
+		return FinishToolCall
+	}
+
+	if maxTokens > 0 && UsageFromGenerationInfo(choice.GenerationInfo).CompletionTokens >= maxTokens {
+		return FinishLength
+	}
+
+	return FinishUnknown
+}
+
+// ResponseFinishReason returns the finish reason of the first choice, or FinishCancelled
+// when err is a context cancellation or deadline, e.g. for the partial text of an aborted stream
+func ResponseFinishReason(resp *lc.ContentResponse, err error, maxTokens int) FinishReason {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return FinishCancelled
+	}
+
+	if resp == nil || len(resp.Choices) == 0 {
+		return FinishUnknown
+	}
+
+	return ChoiceFinishReason(resp.Choices[0], maxTokens)
+}
+
+// IsTruncated reports whether the first choice of the response was cut off by the token limit
+func IsTruncated(resp *lc.ContentResponse, maxTokens int) bool {
+	return ResponseFinishReason(resp, nil, maxTokens) == FinishLength
+}
+
+// ContinueModel wraps a llms.Model to complete the truncated responses: while the response stops
+// because of the token limit, the model is asked to continue from where it stopped, and the parts
+// are stitched together into the first choice. The usage of all the calls is summed up.
+// A streaming func receives every part as it is generated.
+type ContinueModel struct {
+	model            lc.Model
+	maxContinuations int
+	prompt           string
+}
+
+var _ lc.Model = (*ContinueModel)(nil)
+
+// ContinueOption is a functional option for ContinueModel
+type ContinueOption func(*ContinueModel)
+
+// WithMaxContinuations limits how many times a response is continued, 3 by default
+func WithMaxContinuations(n int) ContinueOption {
+	return func(m *ContinueModel) {
+		m.maxContinuations = n
+	}
+}
+
+// WithContinuePrompt replaces the human message asking the model to continue
+func WithContinuePrompt(prompt string) ContinueOption {
+	return func(m *ContinueModel) {
+		m.prompt = prompt
+	}
+}
+
+func NewContinueModel(model lc.Model, opts ...ContinueOption) *ContinueModel {
+	m := &ContinueModel{
+		model:            model,
+		maxContinuations: 3,
+		prompt:           "Continue exactly where you stopped, without repeating anything.",
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// GenerateContent returns the stitched response, which may still be truncated after the last continuation,
+// see IsTruncated. Only the first choice is continued.
+func (m *ContinueModel) GenerateContent(ctx context.Context, messages []lc.MessageContent, options ...lc.CallOption) (*lc.ContentResponse, error) {
+	opts := lc.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	resp, err := m.model.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsTruncated(resp, opts.MaxTokens) {
+		return resp, nil
+	}
+
+	first := *resp.Choices[0]
+	usage := ResponseUsage(resp)
+	conversation := messages[:len(messages):len(messages)]
+
+	continuations := 0
+	for ; continuations < m.maxContinuations && IsTruncated(resp, opts.MaxTokens); continuations++ {
+		conversation = append(conversation,
+			lc.TextParts(lc.ChatMessageTypeAI, resp.Choices[0].Content),
+			lc.TextParts(lc.ChatMessageTypeHuman, m.prompt),
+		)
+
+		resp, err = m.model.GenerateContent(ctx, conversation, options...)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			break
+		}
+
+		first.Content = stitch(first.Content, resp.Choices[0].Content)
+		usage = usage.Add(ResponseUsage(resp))
+	}
+
+	first.GenerationInfo = map[string]any{
+		"PromptTokens":     usage.PromptTokens,
+		"CompletionTokens": usage.CompletionTokens,
+		"TotalTokens":      usage.TotalTokens,
+		"Continuations":    continuations,
+	}
+
+	// the summed usage exceeds the limit, so the normalized reason of the last part is kept,
+	// and a part which is neither truncated nor a tool call is a regular stop
+	first.StopReason = string(ResponseFinishReason(resp, nil, opts.MaxTokens))
+	if first.StopReason == string(FinishUnknown) {
+		first.StopReason = string(FinishStop)
+	}
+
+	return &lc.ContentResponse{Choices: []*lc.ContentChoice{&first}}, nil
+}
+
+func (m *ContinueModel) Call(ctx context.Context, prompt string, options ...lc.CallOption) (string, error) {
+	return lc.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// stitch appends next to text, dropping the start of next which repeats the end of text,
+// as the models often restart the interrupted sentence
+func stitch(text, next string) string {
+	const minOverlap = 8
+
+	for n := min(len(text), len(next)); n >= minOverlap; n-- {
+		if strings.HasSuffix(text, next[:n]) {
+			return text + next[n:]
+		}
+	}
+
+	return text + next
+}
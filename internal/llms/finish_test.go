@@ -0,0 +1,117 @@
+package llms
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// choicesModel answers with its choices in order and records the prompts
+type choicesModel struct {
+	choices []*lc.ContentChoice
+	prompts [][]lc.MessageContent
+}
+
+func (m *choicesModel) GenerateContent(ctx context.Context, messages []lc.MessageContent, options ...lc.CallOption) (*lc.ContentResponse, error) {
+	m.prompts = append(m.prompts, messages)
+
+	choice := m.choices[0]
+	m.choices = m.choices[1:]
+
+	return &lc.ContentResponse{Choices: []*lc.ContentChoice{choice}}, nil
+}
+
+func (m *choicesModel) Call(ctx context.Context, prompt string, options ...lc.CallOption) (string, error) {
+	return lc.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestNormalizeStopReason(t *testing.T) {
+	tests := map[string]FinishReason{
+		"stop":                  FinishStop,
+		"end_turn":              FinishStop,
+		"FinishReasonStop":      FinishStop,
+		"length":                FinishLength,
+		"max_tokens":            FinishLength,
+		"FinishReasonMaxTokens": FinishLength,
+		"tool_calls":            FinishToolCall,
+		"tool_use":              FinishToolCall,
+		"content_filter":        FinishContentFilter,
+		"FinishReasonSafety":    FinishContentFilter,
+		"":                      FinishUnknown,
+		"FinishReasonOther":     FinishUnknown,
+	}
+
+	for raw, want := range tests {
+		if got := NormalizeStopReason(raw); got != want {
+			t.Fatalf("NormalizeStopReason(%q) is %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestResponseFinishReason(t *testing.T) {
+	// Ollama reports no stop reason, only the usage
+	resp := &lc.ContentResponse{Choices: []*lc.ContentChoice{{
+		Content:        "Go is",
+		GenerationInfo: map[string]any{"CompletionTokens": 16},
+	}}}
+
+	if reason := ResponseFinishReason(resp, nil, 16); reason != FinishLength {
+		t.Fatalf("finish reason is %q, want %q", reason, FinishLength)
+	}
+	if reason := ResponseFinishReason(resp, nil, 0); reason != FinishUnknown {
+		t.Fatalf("finish reason without a limit is %q, want %q", reason, FinishUnknown)
+	}
+	if reason := ResponseFinishReason(resp, fmt.Errorf("stream: %w", context.Canceled), 16); reason != FinishCancelled {
+		t.Fatalf("finish reason of a cancelled call is %q, want %q", reason, FinishCancelled)
+	}
+}
+
+func TestContinueModel(t *testing.T) {
+	inner := &choicesModel{choices: []*lc.ContentChoice{
+		{Content: "Go is awesome because of its simple", StopReason: "length", GenerationInfo: map[string]any{"CompletionTokens": 8, "PromptTokens": 20}},
+		{Content: "because of its simple syntax and fast", StopReason: "length", GenerationInfo: map[string]any{"CompletionTokens": 8, "PromptTokens": 40}},
+		{Content: " compilation.", StopReason: "stop", GenerationInfo: map[string]any{"CompletionTokens": 3, "PromptTokens": 60}},
+	}}
+
+	resp, err := NewContinueModel(inner).GenerateContent(t.Context(),
+		[]lc.MessageContent{lc.TextParts(lc.ChatMessageTypeHuman, "Why is Go awesome?")}, lc.WithMaxTokens(8))
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+
+	choice := resp.Choices[0]
+	if want := "Go is awesome because of its simple syntax and fast compilation."; choice.Content != want {
+		t.Fatalf("content is %q, want %q", choice.Content, want)
+	}
+	if IsTruncated(resp, 8) {
+		t.Fatalf("response is truncated, stop reason %q", choice.StopReason)
+	}
+	if usage := ResponseUsage(resp); usage.CompletionTokens != 19 || usage.PromptTokens != 120 {
+		t.Fatalf("usage is %+v, want 19 completion and 120 prompt tokens", usage)
+	}
+
+	// the last prompt carries the partial answer and the request to continue
+	last := inner.prompts[2]
+	if len(last) != 5 || last[3].Role != lc.ChatMessageTypeAI {
+		t.Fatalf("unexpected continuation prompt: %+v", last)
+	}
+}
+
+func TestContinueModel_maxContinuations(t *testing.T) {
+	inner := &choicesModel{choices: []*lc.ContentChoice{
+		{Content: "one ", StopReason: "max_tokens"},
+		{Content: "two ", StopReason: "max_tokens"},
+	}}
+
+	resp, err := NewContinueModel(inner, WithMaxContinuations(1)).GenerateContent(t.Context(),
+		[]lc.MessageContent{lc.TextParts(lc.ChatMessageTypeHuman, "Count")})
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+
+	if !IsTruncated(resp, 0) || resp.Choices[0].Content != "one two " {
+		t.Fatalf("unexpected response: %+v", resp.Choices[0])
+	}
+}
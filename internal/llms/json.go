@@ -0,0 +1,312 @@
+package llms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// JSONRepair describes a defect of the model output fixed before decoding it
+type JSONRepair string
+
+const (
+	RepairCodeFence       JSONRepair = "stripped code fence"
+	RepairSurroundingText JSONRepair = "removed text around the JSON"
+	RepairTrailingComma   JSONRepair = "removed trailing comma"
+	RepairSingleQuotes    JSONRepair = "replaced single quotes"
+	RepairNewlines        JSONRepair = "escaped control characters in strings"
+)
+
+// ErrNoJSON is returned when the text contains no JSON object or array
+var ErrNoJSON = errors.New("no JSON object or array found")
+
+// JSONError describes why the model output could not be decoded, after which repairs
+type JSONError struct {
+	// JSON is the extracted and repaired candidate which failed to decode
+	JSON    string
+	Repairs []JSONRepair
+	// Line and Column locate the error in JSON, they are 0 when unknown
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *JSONError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("decode JSON")
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, " at line %d column %d", e.Line, e.Column)
+	}
+	fmt.Fprintf(&sb, ": %v", e.Err)
+	if len(e.Repairs) > 0 {
+		fmt.Fprintf(&sb, " (repairs: %s)", joinRepairs(e.Repairs))
+	}
+	return sb.String()
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+func joinRepairs(repairs []JSONRepair) string {
+	s := make([]string, len(repairs))
+	for i, r := range repairs {
+		s[i] = string(r)
+	}
+	return strings.Join(s, ", ")
+}
+
+// DecodeJSON decodes the first JSON object or array found in the model output into a T,
+// see ExtractJSON for the repaired defects. The repairs are returned on success too,
+// so the callers can log how far the model is from following the instructions.
+func DecodeJSON[T any](text string) (T, []JSONRepair, error) {
+	var result T
+
+	candidate, repairs, err := ExtractJSON(text)
+	if err != nil {
+		return result, repairs, err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(candidate))
+	if err := dec.Decode(&result); err != nil {
+		return result, repairs, newJSONError(candidate, repairs, err)
+	}
+
+	return result, repairs, nil
+}
+
+var codeFence = regexp.MustCompile("(?s)```[a-zA-Z]*[ \t]*\n?(.*?)```")
+
+// ExtractJSON locates the JSON object or array in free text, e.g. after a preface or inside a Markdown
+// code fence, and repairs the common defects of model output: trailing commas, single quoted strings,
+// and raw newlines or tabs inside strings. The brackets of a preface, e.g. "Here is the result [JSON]:",
+// are skipped when they do not enclose JSON. It returns a *JSONError when no candidate is valid JSON,
+// for the first candidate.
+func ExtractJSON(text string) (string, []JSONRepair, error) {
+	var fenced []JSONRepair
+
+	if m := codeFence.FindStringSubmatch(text); m != nil && strings.ContainsAny(m[1], "{[") {
+		text = m[1]
+		fenced = append(fenced, RepairCodeFence)
+	}
+
+	var first struct {
+		candidate string
+		repairs   []JSONRepair
+		err       error
+	}
+
+	for offset := 0; ; {
+		i := strings.IndexAny(text[offset:], "{[")
+		if i < 0 {
+			break
+		}
+		start := offset + i
+
+		end, err := locateJSON(text, start)
+		if err != nil {
+			var jsonErr *JSONError
+			if errors.As(err, &jsonErr) {
+				jsonErr.Repairs = fenced
+			}
+			if first.err == nil {
+				first.repairs, first.err = fenced, err
+			}
+			if errors.Is(err, errUnterminated) {
+				// the rest of the text is inside the candidate, a nested value is not the answer
+				break
+			}
+			offset = start + 1
+			continue
+		}
+
+		repairs := slices.Clone(fenced)
+		if strings.TrimSpace(text[:start]) != "" || strings.TrimSpace(text[end:]) != "" {
+			repairs = append(repairs, RepairSurroundingText)
+		}
+
+		candidate, fixes, err := repairCandidate(text[start:end])
+		repairs = append(repairs, fixes...)
+		if err == nil {
+			return candidate, repairs, nil
+		}
+
+		if first.err == nil {
+			first.candidate, first.repairs, first.err = candidate, repairs, newJSONError(candidate, repairs, err)
+		}
+		offset = end
+	}
+
+	if first.err == nil {
+		return "", fenced, ErrNoJSON
+	}
+	return first.candidate, first.repairs, first.err
+}
+
+// repairCandidate returns the candidate as is when it is valid, or else repaired with the repairs made
+func repairCandidate(candidate string) (string, []JSONRepair, error) {
+	if json.Valid([]byte(candidate)) {
+		return candidate, nil, nil
+	}
+
+	repaired, repairs := repairJSON(candidate)
+
+	var v any
+	if err := json.Unmarshal([]byte(repaired), &v); err != nil {
+		return repaired, repairs, err
+	}
+
+	return repaired, repairs, nil
+}
+
+// errUnterminated is the error of a candidate whose brackets are still open at the end of the text
+var errUnterminated = errors.New("unterminated JSON")
+
+// locateJSON returns the end of the balanced object or array at start, skipping the brackets inside strings
+func locateJSON(text string, start int) (int, error) {
+	var stack []byte
+	var quote byte
+	escaped := false
+
+	for i := start; i < len(text); i++ {
+		c := text[i]
+
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return 0, &JSONError{JSON: text[start : i+1], Err: fmt.Errorf("unexpected %q at offset %d", c, i-start)}
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i + 1, nil
+			}
+		}
+	}
+
+	return 0, &JSONError{JSON: text[start:], Err: fmt.Errorf("%w, %d brackets left open", errUnterminated, len(stack))}
+}
+
+// repairJSON rewrites the candidate in a single pass, it only changes what is outside of valid JSON
+func repairJSON(s string) (string, []JSONRepair) {
+	var out bytes.Buffer
+	seen := map[JSONRepair]bool{}
+	var repairs []JSONRepair
+	repaired := func(r JSONRepair) {
+		if !seen[r] {
+			seen[r] = true
+			repairs = append(repairs, r)
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch c {
+		case '"', '\'':
+			if c == '\'' {
+				repaired(RepairSingleQuotes)
+			}
+			i = repairString(s, i, &out, repaired)
+		case ',':
+			j := i + 1
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				repaired(RepairTrailingComma)
+				continue
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String(), repairs
+}
+
+// repairString writes the string starting at s[start] as a double quoted JSON string,
+// and returns the index of its closing quote
+func repairString(s string, start int, out *bytes.Buffer, repaired func(JSONRepair)) int {
+	quote := s[start]
+	out.WriteByte('"')
+
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s):
+			if quote == '\'' && s[i+1] == '\'' {
+				// \' is not a valid JSON escape
+				out.WriteByte('\'')
+			} else {
+				out.WriteByte(c)
+				out.WriteByte(s[i+1])
+			}
+			i++
+		case c == quote:
+			out.WriteByte('"')
+			return i
+		case c == '"':
+			// a double quote inside a single quoted string
+			out.WriteString(`\"`)
+		case c == '\n':
+			repaired(RepairNewlines)
+			out.WriteString(`\n`)
+		case c == '\r':
+			repaired(RepairNewlines)
+			out.WriteString(`\r`)
+		case c == '\t':
+			repaired(RepairNewlines)
+			out.WriteString(`\t`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return len(s)
+}
+
+func newJSONError(candidate string, repairs []JSONRepair, err error) *JSONError {
+	e := &JSONError{JSON: candidate, Repairs: repairs, Err: err}
+
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return e
+	}
+	offset = min(offset, int64(len(candidate)))
+
+	e.Line = 1 + strings.Count(candidate[:offset], "\n")
+	e.Column = int(offset) - strings.LastIndex(candidate[:offset], "\n")
+
+	return e
+}
@@ -0,0 +1,98 @@
+package llms
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type evaluation struct {
+	Response string `json:"response"`
+	Reason   string `json:"reason"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := map[string]struct {
+		text    string
+		want    evaluation
+		repairs []JSONRepair
+	}{
+		"valid": {
+			text: `{"response": "yes", "reason": "ok"}`,
+			want: evaluation{Response: "yes", Reason: "ok"},
+		},
+		"code fence with preface": {
+			text:    "Here is my evaluation:\n```json\n{\"response\": \"no\", \"reason\": \"wrong [city]\"}\n```\nHope it helps!",
+			want:    evaluation{Response: "no", Reason: "wrong [city]"},
+			repairs: []JSONRepair{RepairCodeFence},
+		},
+		"preface without fence": {
+			text:    `Response: {"response": "unsure", "reason": "not in the reference"}`,
+			want:    evaluation{Response: "unsure", Reason: "not in the reference"},
+			repairs: []JSONRepair{RepairSurroundingText},
+		},
+		"bracket in preface": {
+			text:    `Here is the result [JSON]: {"response": "yes", "reason": "matches the reference"}`,
+			want:    evaluation{Response: "yes", Reason: "matches the reference"},
+			repairs: []JSONRepair{RepairSurroundingText},
+		},
+		"unbalanced bracket in preface": {
+			text:    `Result (see [1}: {"response": "no", "reason": "wrong city"}`,
+			want:    evaluation{Response: "no", Reason: "wrong city"},
+			repairs: []JSONRepair{RepairSurroundingText},
+		},
+		"trailing comma and single quotes": {
+			text:    `{'response': 'yes', 'reason': 'it\'s "correct"',}`,
+			want:    evaluation{Response: "yes", Reason: `it's "correct"`},
+			repairs: []JSONRepair{RepairSingleQuotes, RepairTrailingComma},
+		},
+		"raw newline in string": {
+			text:    "{\"response\": \"no\", \"reason\": \"first line\nsecond line\"}",
+			want:    evaluation{Response: "no", Reason: "first line\nsecond line"},
+			repairs: []JSONRepair{RepairNewlines},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, repairs, err := DecodeJSON[evaluation](tt.text)
+			if err != nil {
+				t.Fatalf("DecodeJSON: %s", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(repairs, tt.repairs) {
+				t.Fatalf("repairs are %v, want %v", repairs, tt.repairs)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON_errors(t *testing.T) {
+	if _, _, err := DecodeJSON[evaluation]("I am not sure."); !errors.Is(err, ErrNoJSON) {
+		t.Fatalf("error is %v, want ErrNoJSON", err)
+	}
+
+	_, _, err := DecodeJSON[evaluation]("{\"response\": \"yes\",\n\"reason\": \"cut")
+
+	var jsonErr *JSONError
+	if !errors.As(err, &jsonErr) || !strings.Contains(err.Error(), "unterminated") {
+		t.Fatalf("error is %v, want an unterminated JSONError", err)
+	}
+
+	// a truncated object is not replaced by an object nested in it
+	_, _, err = DecodeJSON[evaluation]("{\"response\": {\"text\": \"yes\"}, \"reason\": \"cut")
+	if !errors.As(err, &jsonErr) || !strings.Contains(err.Error(), "unterminated") {
+		t.Fatalf("error is %v, want an unterminated JSONError", err)
+	}
+
+	_, repairs, err := DecodeJSON[evaluation]("{'response': 'yes',\n'reason': 42}")
+	if !errors.As(err, &jsonErr) {
+		t.Fatalf("error is %v, want a JSONError", err)
+	}
+	if jsonErr.Line != 2 || !slices.Equal(repairs, []JSONRepair{RepairSingleQuotes}) {
+		t.Fatalf("unexpected error: %s, line %d", err, jsonErr.Line)
+	}
+}
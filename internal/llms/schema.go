@@ -0,0 +1,246 @@
+package llms
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema derived from Go types and checked by Validate
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	// Ref points to a definition of Defs, for the recursive types
+	Ref  string             `json:"$ref,omitempty"`
+	Defs map[string]*Schema `json:"$defs,omitempty"`
+
+	// target is the definition of Ref, followed by Validate
+	target *Schema
+}
+
+// String returns the schema as indented JSON, to be embedded in a prompt
+func (s *Schema) String() string {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("schema: %s", err)
+	}
+	return string(data)
+}
+
+// SchemaFor derives the JSON Schema of T from its json tags: the fields without omitempty are required,
+// and the description and enum tags document the fields, e.g.
+//
+//	Response string `json:"response" description:"the verdict" enum:"yes,no,unsure"`
+//
+// Unknown properties are not allowed in the objects derived from structs. A recursive struct,
+// e.g. a tree node with its children, is defined once in $defs and referenced with $ref.
+func SchemaFor[T any]() *Schema {
+	b := &schemaBuilder{visiting: map[reflect.Type]*Schema{}, recursive: map[reflect.Type]bool{}}
+
+	s := b.schemaOf(reflect.TypeFor[T]())
+	if len(b.defs) > 0 {
+		s.Defs = b.defs
+	}
+
+	return s
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schemaBuilder tracks the structs being derived, to reference a struct inside itself instead of recursing
+type schemaBuilder struct {
+	visiting  map[reflect.Type]*Schema
+	recursive map[reflect.Type]bool
+	defs      map[string]*Schema
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return b.structSchema(t)
+	default:
+		// interfaces accept any value
+		return &Schema{}
+	}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	if s, ok := b.visiting[t]; ok {
+		b.recursive[t] = true
+		return b.ref(t, s)
+	}
+
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	b.visiting[t] = s
+	defer delete(b.visiting, t)
+
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := b.schemaOf(f.Type)
+		prop.Description = f.Tag.Get("description")
+		if enum := f.Tag.Get("enum"); enum != "" {
+			for _, v := range strings.Split(enum, ",") {
+				prop.Enum = append(prop.Enum, v)
+			}
+		}
+
+		s.Properties[name] = prop
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	if b.recursive[t] {
+		if b.defs == nil {
+			b.defs = map[string]*Schema{}
+		}
+		b.defs[t.Name()] = s
+		return b.ref(t, s)
+	}
+
+	return s
+}
+
+func (b *schemaBuilder) ref(t reflect.Type, s *Schema) *Schema {
+	return &Schema{Ref: "#/$defs/" + t.Name(), target: s}
+}
+
+// Validate checks a decoded JSON value against the schema,
+// it returns one message per violation with the JSON path of the value, e.g. "$.items[1].name".
+func (s *Schema) Validate(v any) []string {
+	var errs []string
+	s.validate("$", v, &errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, v any, errs *[]string) {
+	if s.target != nil {
+		s.target.validate(path, v, errs)
+		return
+	}
+
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		fail("must be one of %v, got %v", s.Enum, jsonString(v))
+		return
+	}
+
+	switch s.Type {
+	case "string":
+		if _, ok := v.(string); !ok {
+			fail("must be a string, got %s", jsonString(v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean, got %s", jsonString(v))
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != float64(int64(f)) {
+			fail("must be an integer, got %s", jsonString(v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			fail("must be a number, got %s", jsonString(v))
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			fail("must be an array, got %s", jsonString(v))
+			return
+		}
+		for i, item := range items {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("must be an object, got %s", jsonString(v))
+			return
+		}
+		s.validateObject(path, obj, errs)
+	}
+}
+
+func (s *Schema) validateObject(path string, obj map[string]any, errs *[]string) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		propPath := path + "." + name
+
+		if prop, ok := s.Properties[name]; ok {
+			prop.validate(propPath, obj[name], errs)
+			continue
+		}
+
+		switch additional := s.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, propPath+": unknown property")
+			}
+		case *Schema:
+			additional.validate(propPath, obj[name], errs)
+		}
+	}
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,217 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// ErrStopSequence is returned by the streaming func to abort the generation when a stop sequence is detected
+var ErrStopSequence = errors.New("stop sequence detected")
+
+// StreamResult is the assembled text of a streamed generation together with its timing
+type StreamResult struct {
+	Text string
+	// Response is nil when the generation was aborted by a stop sequence
+	Response *lc.ContentResponse
+	// StopSequence is the stop sequence which ended the generation, if any
+	StopSequence string
+
+	Chunks           int
+	TimeToFirstToken time.Duration
+	Duration         time.Duration
+	// CompletionTokens is reported by the model, or else estimated as one token per chunk
+	CompletionTokens int
+	// TokensPerSecond is measured after the first token, so it excludes the prompt evaluation
+	TokensPerSecond float64
+}
+
+// StreamAccumulator assembles the chunks of a streamed generation and fans them out to sinks,
+// e.g. stdout to show the progress, a channel for a server or a buffer for a test.
+type StreamAccumulator struct {
+	writers       []io.Writer
+	channels      []chan<- string
+	stopSequences []string
+	holdback      int
+
+	start      time.Time
+	firstToken time.Time
+	chunks     int
+	text       strings.Builder
+	pending    string
+	stopped    string
+}
+
+// StreamAccumulatorOption is a functional option for StreamAccumulator
+type StreamAccumulatorOption func(*StreamAccumulator)
+
+// WithStreamWriter writes every chunk to w, e.g. os.Stdout or a bytes.Buffer
+func WithStreamWriter(w io.Writer) StreamAccumulatorOption {
+	return func(a *StreamAccumulator) {
+		a.writers = append(a.writers, w)
+	}
+}
+
+// WithStreamChannel sends every chunk to ch, blocking until it is received or the context is done.
+// The channel is not closed by the accumulator.
+func WithStreamChannel(ch chan<- string) StreamAccumulatorOption {
+	return func(a *StreamAccumulator) {
+		a.channels = append(a.channels, ch)
+	}
+}
+
+// WithStopSequences aborts the generation as soon as the text contains one of the sequences,
+// for the models and servers which do not support stop sequences. The text is cut before the sequence,
+// and the sinks never receive it, so up to the length of the longest sequence is held back from them.
+func WithStopSequences(sequences ...string) StreamAccumulatorOption {
+	return func(a *StreamAccumulator) {
+		a.stopSequences = append(a.stopSequences, sequences...)
+	}
+}
+
+func NewStreamAccumulator(opts ...StreamAccumulatorOption) *StreamAccumulator {
+	a := &StreamAccumulator{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	for _, seq := range a.stopSequences {
+		a.holdback = max(a.holdback, len(seq)-1)
+	}
+
+	return a
+}
+
+// Generate streams the generation of the model into the sinks. The result carries the text received so far
+// even when an error is returned; an abort by a stop sequence is not an error.
+func (a *StreamAccumulator) Generate(ctx context.Context, model lc.Model, messages []lc.MessageContent, options ...lc.CallOption) (*StreamResult, error) {
+	a.reset()
+
+	options = append(options, lc.WithStreamingFunc(a.stream))
+
+	resp, err := model.GenerateContent(ctx, messages, options...)
+	if errors.Is(err, ErrStopSequence) {
+		err = nil
+	}
+
+	// flush the held back tail, also when the generation failed or was cancelled,
+	// so the text holds everything streamed so far
+	if a.stopped == "" {
+		if flushErr := a.emit(ctx, a.pending); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		a.pending = ""
+	}
+
+	result := a.result(resp)
+	if err != nil {
+		return result, fmt.Errorf("model.GenerateContent: %w", err)
+	}
+
+	return result, nil
+}
+
+func (a *StreamAccumulator) reset() {
+	a.start = time.Now()
+	a.firstToken = time.Time{}
+	a.chunks = 0
+	a.text.Reset()
+	a.pending = ""
+	a.stopped = ""
+}
+
+// stream is the langchaingo streaming func
+func (a *StreamAccumulator) stream(ctx context.Context, chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	if a.firstToken.IsZero() {
+		a.firstToken = time.Now()
+	}
+	a.chunks++
+
+	a.pending += string(chunk)
+
+	for _, seq := range a.stopSequences {
+		if i := strings.Index(a.pending, seq); i >= 0 {
+			a.stopped = seq
+			if err := a.emit(ctx, a.pending[:i]); err != nil {
+				return err
+			}
+			a.pending = ""
+			return ErrStopSequence
+		}
+	}
+
+	// keep the tail which could be the start of a stop sequence, without splitting a rune
+	cut := len(a.pending) - a.holdback
+	for cut > 0 && cut < len(a.pending) && !utf8.RuneStart(a.pending[cut]) {
+		cut--
+	}
+	if cut <= 0 {
+		return nil
+	}
+
+	if err := a.emit(ctx, a.pending[:cut]); err != nil {
+		return err
+	}
+	a.pending = a.pending[cut:]
+
+	return nil
+}
+
+func (a *StreamAccumulator) emit(ctx context.Context, s string) error {
+	if s == "" {
+		return nil
+	}
+
+	a.text.WriteString(s)
+
+	for _, w := range a.writers {
+		if _, err := io.WriteString(w, s); err != nil {
+			return fmt.Errorf("io.WriteString: %w", err)
+		}
+	}
+
+	for _, ch := range a.channels {
+		select {
+		case ch <- s:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (a *StreamAccumulator) result(resp *lc.ContentResponse) *StreamResult {
+	result := &StreamResult{
+		Text:         a.text.String(),
+		Response:     resp,
+		StopSequence: a.stopped,
+		Chunks:       a.chunks,
+		Duration:     time.Since(a.start),
+	}
+
+	if !a.firstToken.IsZero() {
+		result.TimeToFirstToken = a.firstToken.Sub(a.start)
+	}
+
+	result.CompletionTokens = ResponseUsage(resp).CompletionTokens
+	if result.CompletionTokens == 0 {
+		result.CompletionTokens = a.chunks
+	}
+
+	if generation := result.Duration - result.TimeToFirstToken; generation > 0 && result.CompletionTokens > 0 {
+		result.TokensPerSecond = float64(result.CompletionTokens) / generation.Seconds()
+	}
+
+	return result
+}
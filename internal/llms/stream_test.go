@@ -0,0 +1,133 @@
+package llms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// streamingModel streams its chunks, with a delay before each of them
+type streamingModel struct {
+	chunks []string
+	delay  time.Duration
+	sent   int
+	// cancel is called after cancelAfter chunks, like a user interrupting the generation
+	cancel      context.CancelFunc
+	cancelAfter int
+}
+
+func (m *streamingModel) GenerateContent(ctx context.Context, messages []lc.MessageContent, options ...lc.CallOption) (*lc.ContentResponse, error) {
+	opts := lc.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	content := ""
+	for _, chunk := range m.chunks {
+		time.Sleep(m.delay)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := opts.StreamingFunc(ctx, []byte(chunk)); err != nil {
+			return nil, err
+		}
+		m.sent++
+		content += chunk
+		if m.cancel != nil && m.sent == m.cancelAfter {
+			m.cancel()
+		}
+	}
+
+	return &lc.ContentResponse{Choices: []*lc.ContentChoice{{
+		Content:        content,
+		GenerationInfo: map[string]any{"CompletionTokens": len(m.chunks)},
+	}}}, nil
+}
+
+func (m *streamingModel) Call(ctx context.Context, prompt string, options ...lc.CallOption) (string, error) {
+	return lc.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestStreamAccumulator(t *testing.T) {
+	model := &streamingModel{chunks: []string{"Go ", "is ", "great"}, delay: 10 * time.Millisecond}
+
+	var buf bytes.Buffer
+	ch := make(chan string, 10)
+
+	acc := NewStreamAccumulator(WithStreamWriter(&buf), WithStreamChannel(ch))
+
+	result, err := acc.Generate(t.Context(), model, []lc.MessageContent{lc.TextParts(lc.ChatMessageTypeHuman, "Why Go?")})
+	if err != nil {
+		t.Fatalf("Generate: %s", err)
+	}
+	close(ch)
+
+	if result.Text != "Go is great" || buf.String() != result.Text {
+		t.Fatalf("text is %q, buffer is %q, want %q", result.Text, buf.String(), "Go is great")
+	}
+
+	var received string
+	for chunk := range ch {
+		received += chunk
+	}
+	if received != result.Text {
+		t.Fatalf("channel received %q, want %q", received, result.Text)
+	}
+
+	if result.Chunks != 3 || result.CompletionTokens != 3 {
+		t.Fatalf("unexpected counts: %+v", result)
+	}
+	if result.TimeToFirstToken < 10*time.Millisecond || result.TimeToFirstToken >= result.Duration {
+		t.Fatalf("unexpected time to first token: %+v", result)
+	}
+	if result.TokensPerSecond <= 0 {
+		t.Fatalf("tokens per second not measured: %+v", result)
+	}
+}
+
+func TestStreamAccumulator_stopSequence(t *testing.T) {
+	// the stop sequence is split across chunks
+	model := &streamingModel{chunks: []string{"Answer: 42\nUs", "er: and", " then"}}
+
+	var buf bytes.Buffer
+	acc := NewStreamAccumulator(WithStreamWriter(&buf), WithStopSequences("\nUser:"))
+
+	result, err := acc.Generate(t.Context(), model, []lc.MessageContent{lc.TextParts(lc.ChatMessageTypeHuman, "?")})
+	if err != nil {
+		t.Fatalf("Generate: %s", err)
+	}
+
+	if result.Text != "Answer: 42" || buf.String() != "Answer: 42" {
+		t.Fatalf("text is %q, buffer is %q, want %q", result.Text, buf.String(), "Answer: 42")
+	}
+	if result.StopSequence != "\nUser:" || result.Response != nil {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if model.sent != 1 {
+		t.Fatalf("model sent %d chunks, want the generation aborted after the second one", model.sent)
+	}
+}
+
+func TestStreamAccumulator_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	model := &streamingModel{chunks: []string{"Once upon", " a time", " there was"}, cancel: cancel, cancelAfter: 2}
+
+	var buf bytes.Buffer
+	acc := NewStreamAccumulator(WithStreamWriter(&buf), WithStopSequences("\nYou:"))
+
+	result, err := acc.Generate(ctx, model, []lc.MessageContent{lc.TextParts(lc.ChatMessageTypeHuman, "Tell me a story.")})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Generate returned %v, want context.Canceled", err)
+	}
+
+	// the tail held back for the stop sequence is not lost
+	if result.Text != "Once upon a time" || buf.String() != result.Text {
+		t.Fatalf("text is %q, buffer is %q, want %q", result.Text, buf.String(), "Once upon a time")
+	}
+}
@@ -0,0 +1,114 @@
+package llms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// StructuredOutputError is returned by GenerateStructured when no attempt produced a valid output
+type StructuredOutputError struct {
+	Attempts int
+	// Output is the last output of the model
+	Output string
+	// Errors are the validation errors of the last output
+	Errors []string
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("no valid output after %d attempts: %s", e.Attempts, strings.Join(e.Errors, "; "))
+}
+
+// StructuredOption is a functional option for GenerateStructured
+type StructuredOption func(*structuredOptions)
+
+type structuredOptions struct {
+	attempts    int
+	callOptions []lc.CallOption
+}
+
+// WithStructuredAttempts sets how many times the model is asked for a valid output, 3 by default and at least 1
+func WithStructuredAttempts(n int) StructuredOption {
+	return func(o *structuredOptions) {
+		o.attempts = max(n, 1)
+	}
+}
+
+// WithStructuredCallOptions sets the options of every model call, e.g. the temperature
+func WithStructuredCallOptions(opts ...lc.CallOption) StructuredOption {
+	return func(o *structuredOptions) {
+		o.callOptions = append(o.callOptions, opts...)
+	}
+}
+
+// GenerateStructured asks the model for a JSON output conforming to the schema derived from T, see SchemaFor.
+// The schema is added to the prompt, and the calls use the JSON mode, which sets the Ollama format parameter
+// to "json" and the OpenAI response format to a JSON object; langchaingo does not pass the schema itself.
+// Every output is repaired, see ExtractJSON, and validated against the schema. When it is invalid, the model
+// is asked again with the validation errors, up to the number of attempts.
+func GenerateStructured[T any](ctx context.Context, model lc.Model, messages []lc.MessageContent, opts ...StructuredOption) (T, error) {
+	var result T
+
+	o := &structuredOptions{attempts: 3}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	schema := SchemaFor[T]()
+
+	conversation := append(messages[:len(messages):len(messages)], lc.TextParts(lc.ChatMessageTypeHuman,
+		"Respond only with a JSON value conforming to this JSON Schema, without any other text:\n"+schema.String()))
+
+	callOptions := append(o.callOptions[:len(o.callOptions):len(o.callOptions)], lc.WithJSONMode())
+
+	var output string
+	var errs []string
+
+	for attempt := 1; attempt <= o.attempts; attempt++ {
+		resp, err := model.GenerateContent(ctx, conversation, callOptions...)
+		if err != nil {
+			return result, fmt.Errorf("model.GenerateContent: %w", err)
+		}
+
+		output = strings.Join(ContentResponseToStrings(resp), "")
+
+		errs = validateOutput(schema, output, &result)
+		if len(errs) == 0 {
+			return result, nil
+		}
+
+		conversation = append(conversation,
+			lc.TextParts(lc.ChatMessageTypeAI, output),
+			lc.TextParts(lc.ChatMessageTypeHuman, "Your response is invalid:\n- "+strings.Join(errs, "\n- ")+
+				"\nRespond again with only the corrected JSON."),
+		)
+	}
+
+	return result, &StructuredOutputError{Attempts: o.attempts, Output: output, Errors: errs}
+}
+
+// validateOutput decodes the output into result, it returns the errors to send back to the model
+func validateOutput(schema *Schema, output string, result any) []string {
+	candidate, _, err := ExtractJSON(output)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(candidate), &v); err != nil {
+		return []string{err.Error()}
+	}
+
+	if errs := schema.Validate(v); len(errs) > 0 {
+		return errs
+	}
+
+	if err := json.Unmarshal([]byte(candidate), result); err != nil {
+		return []string{err.Error()}
+	}
+
+	return nil
+}
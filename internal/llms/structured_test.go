@@ -0,0 +1,142 @@
+package llms
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// scriptedModel answers with its outputs in order and records the prompts
+type scriptedModel struct {
+	outputs []string
+	prompts [][]lc.MessageContent
+	opts    []lc.CallOptions
+}
+
+func (m *scriptedModel) GenerateContent(ctx context.Context, messages []lc.MessageContent, options ...lc.CallOption) (*lc.ContentResponse, error) {
+	opts := lc.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	m.prompts = append(m.prompts, messages)
+	m.opts = append(m.opts, opts)
+
+	output := m.outputs[0]
+	m.outputs = m.outputs[1:]
+
+	return &lc.ContentResponse{Choices: []*lc.ContentChoice{{Content: output}}}, nil
+}
+
+func (m *scriptedModel) Call(ctx context.Context, prompt string, options ...lc.CallOption) (string, error) {
+	return lc.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+type verdict struct {
+	Response string   `json:"response" description:"the verdict" enum:"yes,no,unsure"`
+	Reason   string   `json:"reason"`
+	Sources  []string `json:"sources,omitempty"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor[verdict]()
+
+	for _, want := range []string{
+		`"required": [
+    "response",
+    "reason"
+  ]`,
+		`"enum": [
+        "yes",
+        "no",
+        "unsure"
+      ]`,
+		`"additionalProperties": false`,
+	} {
+		if !strings.Contains(schema.String(), want) {
+			t.Errorf("schema does not contain %s:\n%s", want, schema)
+		}
+	}
+
+	errs := schema.Validate(map[string]any{"response": "maybe", "sources": []any{"doc", 1.0}, "extra": true})
+	want := []string{
+		`$: missing required property "reason"`,
+		`$.extra: unknown property`,
+		`$.response: must be one of [yes no unsure], got "maybe"`,
+		`$.sources[1]: must be a string, got 1`,
+	}
+	if strings.Join(errs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("validation errors are\n%s\nwant\n%s", strings.Join(errs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// node is a recursive type, its schema references itself
+type node struct {
+	Name     string `json:"name"`
+	Children []node `json:"children,omitempty"`
+	Parent   *node  `json:"parent,omitempty"`
+}
+
+func TestSchemaFor_recursive(t *testing.T) {
+	schema := SchemaFor[node]()
+
+	if schema.Ref != "#/$defs/node" || schema.Defs["node"].Properties["children"].Items.Ref != "#/$defs/node" {
+		t.Fatalf("unexpected schema:\n%s", schema)
+	}
+
+	errs := schema.Validate(map[string]any{"name": "root", "children": []any{
+		map[string]any{"name": "leaf"},
+		map[string]any{"children": []any{}},
+	}})
+	if strings.Join(errs, "\n") != `$.children[1]: missing required property "name"` {
+		t.Fatalf("unexpected validation errors: %q", errs)
+	}
+}
+
+func TestGenerateStructured(t *testing.T) {
+	model := &scriptedModel{outputs: []string{
+		`{"response": "maybe", "reason": "not sure"}`,
+		"```json\n{\"response\": \"unsure\", \"reason\": \"not sure\"}\n```",
+	}}
+
+	got, err := GenerateStructured[verdict](t.Context(), model, []lc.MessageContent{
+		lc.TextParts(lc.ChatMessageTypeHuman, "Is Madrid the capital of Spain?"),
+	})
+	if err != nil {
+		t.Fatalf("GenerateStructured: %s", err)
+	}
+
+	if got.Response != "unsure" || got.Reason != "not sure" {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+
+	if len(model.prompts) != 2 || !model.opts[0].JSONMode {
+		t.Fatalf("model called %d times, JSON mode %t", len(model.prompts), model.opts[0].JSONMode)
+	}
+
+	reprompt := model.prompts[1][len(model.prompts[1])-1].Parts[0].(lc.TextContent).Text
+	if !strings.Contains(reprompt, `$.response: must be one of [yes no unsure], got "maybe"`) {
+		t.Fatalf("re-prompt does not contain the validation error:\n%s", reprompt)
+	}
+}
+
+func TestGenerateStructured_attempts(t *testing.T) {
+	model := &scriptedModel{outputs: []string{"I don't know", "Still no idea"}}
+
+	_, err := GenerateStructured[verdict](t.Context(), model, nil, WithStructuredAttempts(2))
+
+	var structuredErr *StructuredOutputError
+	if !errors.As(err, &structuredErr) || structuredErr.Attempts != 2 || structuredErr.Output != "Still no idea" {
+		t.Fatalf("error is %v, want a StructuredOutputError after 2 attempts", err)
+	}
+
+	// the model is asked at least once
+	model = &scriptedModel{outputs: []string{"I don't know"}}
+	_, err = GenerateStructured[verdict](t.Context(), model, nil, WithStructuredAttempts(0))
+	if !errors.As(err, &structuredErr) || structuredErr.Attempts != 1 || len(model.prompts) != 1 {
+		t.Fatalf("error is %v after %d calls, want a StructuredOutputError after 1 attempt", err, len(model.prompts))
+	}
+}
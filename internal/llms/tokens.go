@@ -0,0 +1,279 @@
+package llms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// Tokenizer counts the tokens of a text for a model family
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// ApproxTokenizer estimates the tokens from the number of characters,
+// about 4 characters per token for English text with the GPT and Llama 3 tokenizers
+type ApproxTokenizer struct {
+	CharsPerToken float64
+}
+
+func (t ApproxTokenizer) CountTokens(text string) int {
+	charsPerToken := t.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = 4
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / charsPerToken))
+}
+
+// BPETokenizer counts the tokens exactly with a byte pair encoding
+type BPETokenizer struct {
+	enc *tiktoken.Tiktoken
+}
+
+func (t *BPETokenizer) CountTokens(text string) int {
+	return len(t.enc.EncodeOrdinary(text))
+}
+
+// NewTiktokenTokenizer returns the tiktoken encoding of an OpenAI model. The encoding is downloaded
+// on first use and cached in TIKTOKEN_CACHE_DIR. The gpt-4o and o-series models use cl100k_base here,
+// as tiktoken-go does not have their o200k_base encoding, so their counts are close but not exact.
+func NewTiktokenTokenizer(model string) (*BPETokenizer, error) {
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tiktoken.GetEncoding: %w", err)
+	}
+
+	return &BPETokenizer{enc: enc}, nil
+}
+
+// llama3Pattern splits the text into the pieces encoded separately by the Llama 3 tokenizer
+const llama3Pattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+// NewVocabTokenizer loads a vocabulary in the tiktoken format, one base64 token and its rank per line,
+// e.g. the tokenizer.model file of Llama 3 models, which is downloaded together with their weights
+func NewVocabTokenizer(path string) (*BPETokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	ranks := make(map[string]int)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		token, rank, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want a token and a rank", i+1)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: base64.DecodeString: %w", i+1, err)
+		}
+
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: strconv.Atoi: %w", i+1, err)
+		}
+
+		ranks[string(decoded)] = r
+	}
+
+	bpe, err := tiktoken.NewCoreBPE(ranks, map[string]int{}, llama3Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("tiktoken.NewCoreBPE: %w", err)
+	}
+
+	encoding := &tiktoken.Encoding{Name: path, PatStr: llama3Pattern, MergeableRanks: ranks, SpecialTokens: map[string]int{}}
+
+	return &BPETokenizer{enc: tiktoken.NewTiktoken(bpe, encoding, map[string]any{})}, nil
+}
+
+// ContextWindows maps the model names to their context windows in tokens,
+// the models are looked up like in Pricing
+type ContextWindows map[string]int
+
+// OllamaContextWindow is the context window Ollama serves a model with unless num_ctx is set,
+// whatever the model supports, see ollama.WithRunnerNumCtx and WithContextWindow
+const OllamaContextWindow = 2048
+
+// DefaultContextWindows are the context windows of the OpenAI models used by the examples.
+// The local models are left out, as Ollama serves them with OllamaContextWindow unless num_ctx is set.
+var DefaultContextWindows = ContextWindows{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+}
+
+// Window returns the context window of the model, false when it is not in the table
+func (w ContextWindows) Window(model string) (int, bool) {
+	return lookupModel(w, model)
+}
+
+// TokenCounter estimates the tokens of a prompt before it is sent, to know how much room
+// remains for the completion in the context window of the model
+type TokenCounter struct {
+	model      string
+	window     int
+	perMessage int
+	perImage   int
+
+	once      sync.Once
+	tokenizer Tokenizer
+}
+
+// TokenCounterOption is a functional option for TokenCounter
+type TokenCounterOption func(*TokenCounter)
+
+// WithTokenizer sets the tokenizer, e.g. a NewVocabTokenizer for a local model
+func WithTokenizer(tokenizer Tokenizer) TokenCounterOption {
+	return func(c *TokenCounter) {
+		c.tokenizer = tokenizer
+	}
+}
+
+// WithContextWindow overrides the context window of the model, e.g. to the num_ctx of Ollama
+func WithContextWindow(tokens int) TokenCounterOption {
+	return func(c *TokenCounter) {
+		c.window = tokens
+	}
+}
+
+// WithMessageOverhead sets the tokens added to every message by the chat template, 4 by default
+func WithMessageOverhead(tokens int) TokenCounterOption {
+	return func(c *TokenCounter) {
+		c.perMessage = tokens
+	}
+}
+
+// WithImageTokens sets the estimate of the tokens of an image part, 765 by default,
+// the cost of a 1024x1024 image for the OpenAI vision models
+func WithImageTokens(tokens int) TokenCounterOption {
+	return func(c *TokenCounter) {
+		c.perImage = tokens
+	}
+}
+
+// NewTokenCounter creates a counter for the model. Unless WithTokenizer is set, the OpenAI models
+// are counted with tiktoken, falling back to the ApproxTokenizer when its encoding cannot be loaded,
+// and the other models are approximated. The context window is taken from DefaultContextWindows,
+// it is unknown for the other models unless WithContextWindow is set, e.g. to OllamaContextWindow.
+func NewTokenCounter(model string, opts ...TokenCounterOption) *TokenCounter {
+	c := &TokenCounter{
+		model:      model,
+		perMessage: 4,
+		perImage:   765,
+	}
+
+	if window, ok := DefaultContextWindows.Window(model); ok {
+		c.window = window
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// getTokenizer loads the default tokenizer on first use, as tiktoken downloads its encoding
+func (c *TokenCounter) getTokenizer() Tokenizer {
+	c.once.Do(func() {
+		if c.tokenizer != nil {
+			return
+		}
+
+		c.tokenizer = ApproxTokenizer{}
+		if !isOpenAIModel(c.model) {
+			return
+		}
+
+		if tokenizer, err := NewTiktokenTokenizer(c.model); err == nil {
+			c.tokenizer = tokenizer
+		}
+	})
+
+	return c.tokenizer
+}
+
+func isOpenAIModel(model string) bool {
+	for _, prefix := range []string{"gpt-", "o1", "o3", "o4", "text-"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContextWindow returns the context window of the model in tokens, 0 when it is unknown
+func (c *TokenCounter) ContextWindow() int {
+	return c.window
+}
+
+// CountTokens returns the tokens of a text
+func (c *TokenCounter) CountTokens(text string) int {
+	return c.getTokenizer().CountTokens(text)
+}
+
+// CountMessages estimates the prompt tokens of the messages: their text, tool calls and responses,
+// a fixed estimate per image and the overhead of the chat template
+func (c *TokenCounter) CountMessages(messages []lc.MessageContent) int {
+	tokenizer := c.getTokenizer()
+
+	var tokens int
+	for _, message := range messages {
+		tokens += c.perMessage
+
+		for _, part := range message.Parts {
+			switch p := part.(type) {
+			case lc.TextContent:
+				tokens += tokenizer.CountTokens(p.Text)
+			case lc.ImageURLContent, lc.BinaryContent:
+				tokens += c.perImage
+			case lc.ToolCall:
+				if p.FunctionCall != nil {
+					tokens += tokenizer.CountTokens(p.FunctionCall.Name) + tokenizer.CountTokens(p.FunctionCall.Arguments)
+				}
+			case lc.ToolCallResponse:
+				tokens += tokenizer.CountTokens(p.Name) + tokenizer.CountTokens(p.Content)
+			default:
+				if data, err := json.Marshal(part); err == nil {
+					tokens += tokenizer.CountTokens(string(data))
+				}
+			}
+		}
+	}
+
+	// every reply is primed with the assistant role
+	if len(messages) > 0 {
+		tokens += 3
+	}
+
+	return tokens
+}
+
+// Remaining returns the tokens left for the completion after the messages, negative when
+// the messages alone do not fit into the context window, math.MaxInt when the window is unknown
+func (c *TokenCounter) Remaining(messages []lc.MessageContent) int {
+	if c.window == 0 {
+		return math.MaxInt
+	}
+	return c.window - c.CountMessages(messages)
+}
@@ -0,0 +1,72 @@
+package llms
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+func TestNewVocabTokenizer(t *testing.T) {
+	// every byte is a token, and "ab" and " ab" are merged
+	var vocab strings.Builder
+	for b := range 256 {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	fmt.Fprintf(&vocab, "%s 256\n", base64.StdEncoding.EncodeToString([]byte("ab")))
+	fmt.Fprintf(&vocab, "%s 257\n", base64.StdEncoding.EncodeToString([]byte(" ab")))
+
+	path := filepath.Join(t.TempDir(), "tokenizer.model")
+	if err := os.WriteFile(path, []byte(vocab.String()), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %s", err)
+	}
+
+	tokenizer, err := NewVocabTokenizer(path)
+	if err != nil {
+		t.Fatalf("NewVocabTokenizer: %s", err)
+	}
+
+	// "ab", " ab" and "c"
+	if n := tokenizer.CountTokens("ab abc"); n != 3 {
+		t.Fatalf("CountTokens is %d, want 3", n)
+	}
+}
+
+func TestTokenCounter(t *testing.T) {
+	counter := NewTokenCounter("llama3.2:1b", WithContextWindow(100), WithTokenizer(ApproxTokenizer{CharsPerToken: 4}))
+
+	messages := []lc.MessageContent{
+		lc.TextParts(lc.ChatMessageTypeSystem, "You are a fellow Go developer."),
+		lc.TextParts(lc.ChatMessageTypeHuman, "Why is Go awesome?"),
+	}
+
+	// 2 * 4 per message + 8 + 5 text + 3 to prime the reply
+	if n := counter.CountMessages(messages); n != 24 {
+		t.Fatalf("CountMessages is %d, want 24", n)
+	}
+	if n := counter.Remaining(messages); n != 76 {
+		t.Fatalf("Remaining is %d, want 76", n)
+	}
+}
+
+func TestContextWindows_Window(t *testing.T) {
+	if n, ok := DefaultContextWindows.Window("gpt-4o-mini-2024-07-18"); !ok || n != 128000 {
+		t.Fatalf("gpt-4o-mini-2024-07-18 window is %d, want 128000", n)
+	}
+
+	// the window of the other models is unknown, not guessed from the Ollama default
+	for _, model := range []string{"llama3.2", "llama3.2:1b", "gpt-4.1", "o1"} {
+		counter := NewTokenCounter(model, WithTokenizer(ApproxTokenizer{}))
+		if n := counter.ContextWindow(); n != 0 {
+			t.Fatalf("%s window is %d, want unknown", model, n)
+		}
+		if n := counter.Remaining([]lc.MessageContent{lc.TextParts(lc.ChatMessageTypeHuman, "Hello")}); n != math.MaxInt {
+			t.Fatalf("%s remaining is %d, want math.MaxInt", model, n)
+		}
+	}
+}
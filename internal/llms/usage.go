@@ -0,0 +1,184 @@
+package llms
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+// Usage is the token usage of one or more model calls, whatever the provider reports it
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// CachedTokens is the part of the prompt served from the provider prompt cache
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// ReasoningTokens is the part of the completion spent on reasoning, not returned as content
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+	// EvalDuration and LoadDuration are reported by Ollama, see internalmodels.NewModel
+	EvalDuration time.Duration `json:"eval_duration,omitempty"`
+	LoadDuration time.Duration `json:"load_duration,omitempty"`
+}
+
+// Add returns the sum of both usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+		CachedTokens:     u.CachedTokens + other.CachedTokens,
+		ReasoningTokens:  u.ReasoningTokens + other.ReasoningTokens,
+		EvalDuration:     u.EvalDuration + other.EvalDuration,
+		LoadDuration:     u.LoadDuration + other.LoadDuration,
+	}
+}
+
+// IsZero reports whether nothing was reported
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+// The GenerationInfo keys of the langchaingo backends, in order of preference:
+// ollama and openai use CompletionTokens, PromptTokens and TotalTokens,
+// anthropic uses InputTokens and OutputTokens, the snake case keys are the raw API names.
+var (
+	promptTokensKeys     = []string{"PromptTokens", "InputTokens", "prompt_tokens", "input_tokens", "PromptEvalCount", "prompt_eval_count"}
+	completionTokensKeys = []string{"CompletionTokens", "OutputTokens", "completion_tokens", "output_tokens", "EvalCount", "eval_count"}
+	totalTokensKeys      = []string{"TotalTokens", "total_tokens"}
+	cachedTokensKeys     = []string{"CachedTokens", "PromptCachedTokens", "cached_tokens"}
+	reasoningTokensKeys  = []string{"ReasoningTokens", "reasoning_tokens"}
+	evalDurationKeys     = []string{"EvalDuration", "eval_duration"}
+	loadDurationKeys     = []string{"LoadDuration", "load_duration"}
+)
+
+// responseTotalsKeys tell the backends which copy the usage of the whole response into every choice:
+// openai is the only one setting ReasoningTokens, and anthropic the only one setting InputTokens
+var responseTotalsKeys = []string{"ReasoningTokens", "InputTokens"}
+
+// UsageFromGenerationInfo extracts the usage of a choice. The counts can be any integer or float type,
+// json.Number or a numeric string; the durations are time.Duration or nanoseconds, as reported by Ollama.
+// TotalTokens is computed when the provider only reports the prompt and completion tokens.
+func UsageFromGenerationInfo(info map[string]any) Usage {
+	u := Usage{
+		PromptTokens:     lookupInt(info, promptTokensKeys),
+		CompletionTokens: lookupInt(info, completionTokensKeys),
+		TotalTokens:      lookupInt(info, totalTokensKeys),
+		CachedTokens:     lookupInt(info, cachedTokensKeys),
+		ReasoningTokens:  lookupInt(info, reasoningTokensKeys),
+		EvalDuration:     lookupDuration(info, evalDurationKeys),
+		LoadDuration:     lookupDuration(info, loadDurationKeys),
+	}
+
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+
+	return u
+}
+
+// ResponseUsage returns the usage of a response. The openai and anthropic backends copy the usage
+// of the whole response into every choice, so it is taken once from the first choice; the usages
+// of the choices of the other backends are summed.
+func ResponseUsage(response *lc.ContentResponse) Usage {
+	if response == nil {
+		return Usage{}
+	}
+
+	var result Usage
+	for _, choice := range response.Choices {
+		if choice == nil {
+			continue
+		}
+
+		if reportsResponseTotals(choice.GenerationInfo) {
+			return UsageFromGenerationInfo(choice.GenerationInfo)
+		}
+
+		result = result.Add(UsageFromGenerationInfo(choice.GenerationInfo))
+	}
+
+	return result
+}
+
+func reportsResponseTotals(info map[string]any) bool {
+	for _, key := range responseTotalsKeys {
+		if _, ok := info[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ConversationUsage sums the usage of the responses of a conversation
+func ConversationUsage(responses ...*lc.ContentResponse) Usage {
+	var result Usage
+	for _, response := range responses {
+		result = result.Add(ResponseUsage(response))
+	}
+	return result
+}
+
+func lookupInt(info map[string]any, keys []string) int {
+	for _, key := range keys {
+		if n, ok := toInt(info[key]); ok {
+			return n
+		}
+	}
+	return 0
+}
+
+func lookupDuration(info map[string]any, keys []string) time.Duration {
+	for _, key := range keys {
+		if d, ok := info[key].(time.Duration); ok {
+			return d
+		}
+		if n, ok := toInt(info[key]); ok {
+			return time.Duration(n)
+		}
+	}
+	return 0
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint:
+		return int(n), true
+	case uint8:
+		return int(n), true
+	case uint16:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	case float32:
+		return int(math.Round(float64(n))), true
+	case float64:
+		return int(math.Round(n)), true
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return int(i), true
+		}
+		if f, err := n.Float64(); err == nil {
+			return int(math.Round(f)), true
+		}
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return int(math.Round(f)), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,72 @@
+package llms
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	lc "github.com/tmc/langchaingo/llms"
+)
+
+func TestUsageFromGenerationInfo(t *testing.T) {
+	tests := map[string]struct {
+		info map[string]any
+		want Usage
+	}{
+		"ollama": {
+			info: map[string]any{"CompletionTokens": 8, "PromptTokens": 26, "TotalTokens": 34},
+			want: Usage{PromptTokens: 26, CompletionTokens: 8, TotalTokens: 34},
+		},
+		"openai": {
+			info: map[string]any{"CompletionTokens": 120, "PromptTokens": 30, "TotalTokens": 150, "ReasoningTokens": 64},
+			want: Usage{PromptTokens: 30, CompletionTokens: 120, TotalTokens: 150, ReasoningTokens: 64},
+		},
+		"anthropic without total": {
+			info: map[string]any{"InputTokens": 10, "OutputTokens": 5},
+			want: Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		},
+		"float64 from JSON": {
+			info: map[string]any{"prompt_tokens": float64(12), "completion_tokens": float64(3), "cached_tokens": float64(8)},
+			want: Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15, CachedTokens: 8},
+		},
+		"raw ollama stats": {
+			info: map[string]any{
+				"prompt_eval_count": json.Number("26"),
+				"eval_count":        json.Number("8"),
+				"eval_duration":     int64(250 * time.Millisecond),
+				"LoadDuration":      2 * time.Second,
+			},
+			want: Usage{PromptTokens: 26, CompletionTokens: 8, TotalTokens: 34, EvalDuration: 250 * time.Millisecond, LoadDuration: 2 * time.Second},
+		},
+		"nothing reported": {
+			info: map[string]any{"StopReason": "stop"},
+			want: Usage{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := UsageFromGenerationInfo(tt.info); got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversationUsage(t *testing.T) {
+	openaiUsage := map[string]any{"CompletionTokens": 20, "PromptTokens": 10, "TotalTokens": 30, "ReasoningTokens": 0}
+	choiceUsage := map[string]any{"CompletionTokens": 5, "PromptTokens": 40}
+
+	responses := []*lc.ContentResponse{
+		// n=2 with the usage of the whole response copied into both choices
+		{Choices: []*lc.ContentChoice{{GenerationInfo: openaiUsage}, {GenerationInfo: openaiUsage}}},
+		// two choices with their own usage, equal by chance
+		{Choices: []*lc.ContentChoice{nil, {GenerationInfo: choiceUsage}, {GenerationInfo: choiceUsage}}},
+		nil,
+	}
+
+	want := Usage{PromptTokens: 90, CompletionTokens: 30, TotalTokens: 120}
+	if got := ConversationUsage(responses...); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
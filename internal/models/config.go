@@ -0,0 +1,193 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config configures the models of an example, e.g.
+//
+//	chat:
+//	  provider: openai
+//	  model: gpt-4o-mini
+//	  token: ${OPENAI_API_KEY}
+//	  timeout: 2m
+//	embedding:
+//	  provider: ollama
+//	  model: nomic-embed-text:v1.5
+//	  transport: [logging, breaker, retry]
+type Config struct {
+	Chat      ModelConfig `yaml:"chat"`
+	Embedding ModelConfig `yaml:"embedding"`
+}
+
+// ModelConfig configures a model and the HTTP client used to call it
+type ModelConfig struct {
+	// Provider is a registered provider, see Register: ollama, openai or fake
+	Provider string `yaml:"provider"`
+	Model    string `yaml:"model"`
+	// URL is the server URL, the default of the provider when empty
+	URL string `yaml:"url"`
+	// Token is the API key, OPENAI_API_KEY for openai when empty
+	Token string `yaml:"token"`
+	// Timeout limits a whole call, including the reading of a streamed response, unlimited when 0
+	Timeout time.Duration `yaml:"timeout"`
+	// ContextWindow sets the num_ctx of Ollama, the server default when 0
+	ContextWindow int `yaml:"context_window"`
+	// Transport is the middleware chain of the HTTP client, outermost first, see RegisterTransport.
+	// DefaultTransport is used when it is nil, an empty list disables the middleware.
+	Transport []string `yaml:"transport"`
+	// Tracing wraps the model into the OpenTelemetry spans of the tracing package, nil when not set,
+	// so that a later layer can turn it off, see TracingEnabled
+	Tracing *bool `yaml:"tracing"`
+}
+
+// TracingEnabled reports whether Tracing is set to true
+func (c ModelConfig) TracingEnabled() bool {
+	return c.Tracing != nil && *c.Tracing
+}
+
+// DefaultTransport logs and retries the calls, like the examples did before the configuration
+var DefaultTransport = []string{"logging", "retry"}
+
+// DefaultOllamaURL is the address of a local Ollama server
+const DefaultOllamaURL = "http://localhost:11434"
+
+// Ollama returns the configuration of a model served by the local Ollama
+func Ollama(model string) ModelConfig {
+	return ModelConfig{Provider: "ollama", Model: model, URL: DefaultOllamaURL}
+}
+
+// OpenAI returns the configuration of an OpenAI model, the token is read from OPENAI_API_KEY
+func OpenAI(model string) ModelConfig {
+	return ModelConfig{Provider: "openai", Model: model}
+}
+
+// Load returns the defaults of an example overridden by the YAML file in LLM_CONFIG, if set,
+// and then by the environment, see ConfigFromEnv
+func Load(defaults Config) (Config, error) {
+	cfg := defaults
+
+	if path := os.Getenv("LLM_CONFIG"); path != "" {
+		var err error
+		if cfg, err = LoadFile(path, cfg); err != nil {
+			return Config{}, fmt.Errorf("LoadFile: %w", err)
+		}
+	}
+
+	return ConfigFromEnv(cfg)
+}
+
+// LoadFile overrides the defaults with the fields set in the YAML file at path.
+// The environment variables in the file are expanded, e.g. ${OPENAI_API_KEY}.
+func LoadFile(path string, defaults Config) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	var file Config
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+		return Config{}, fmt.Errorf("yaml.Unmarshal: %w", err)
+	}
+
+	return Config{
+		Chat:      defaults.Chat.merge(file.Chat),
+		Embedding: defaults.Embedding.merge(file.Embedding),
+	}, nil
+}
+
+// ConfigFromEnv overrides the chat model with the LLM_PROVIDER, LLM_MODEL, LLM_URL, LLM_TOKEN,
+// LLM_TIMEOUT, LLM_CONTEXT_WINDOW, LLM_TRANSPORT (comma separated) and LLM_TRACING (true or false) variables,
+// and the embedding model with the same variables prefixed by LLM_EMBEDDING_ instead of LLM_
+func ConfigFromEnv(cfg Config) (Config, error) {
+	var err error
+
+	if cfg.Chat, err = modelFromEnv("LLM_", cfg.Chat); err != nil {
+		return Config{}, fmt.Errorf("chat: %w", err)
+	}
+	if cfg.Embedding, err = modelFromEnv("LLM_EMBEDDING_", cfg.Embedding); err != nil {
+		return Config{}, fmt.Errorf("embedding: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func modelFromEnv(prefix string, cfg ModelConfig) (ModelConfig, error) {
+	env := ModelConfig{
+		Provider: os.Getenv(prefix + "PROVIDER"),
+		Model:    os.Getenv(prefix + "MODEL"),
+		URL:      os.Getenv(prefix + "URL"),
+		Token:    os.Getenv(prefix + "TOKEN"),
+	}
+
+	if v := os.Getenv(prefix + "TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return ModelConfig{}, fmt.Errorf("%sTIMEOUT: %w", prefix, err)
+		}
+		env.Timeout = timeout
+	}
+
+	if v := os.Getenv(prefix + "CONTEXT_WINDOW"); v != "" {
+		if _, err := fmt.Sscan(v, &env.ContextWindow); err != nil {
+			return ModelConfig{}, fmt.Errorf("%sCONTEXT_WINDOW: %w", prefix, err)
+		}
+	}
+
+	if v, ok := os.LookupEnv(prefix + "TRANSPORT"); ok {
+		env.Transport = []string{}
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				env.Transport = append(env.Transport, name)
+			}
+		}
+	}
+
+	if v := os.Getenv(prefix + "TRACING"); v != "" {
+		tracing, err := strconv.ParseBool(v)
+		if err != nil {
+			return ModelConfig{}, fmt.Errorf("%sTRACING: %w", prefix, err)
+		}
+		env.Tracing = &tracing
+	}
+
+	return cfg.merge(env), nil
+}
+
+// merge returns the configuration overridden by the fields set in other.
+// Changing the provider resets the URL, as it belongs to the previous provider.
+func (c ModelConfig) merge(other ModelConfig) ModelConfig {
+	if other.Provider != "" && other.Provider != c.Provider {
+		c.Provider = other.Provider
+		c.URL = ""
+	}
+	if other.Model != "" {
+		c.Model = other.Model
+	}
+	if other.URL != "" {
+		c.URL = other.URL
+	}
+	if other.Token != "" {
+		c.Token = other.Token
+	}
+	if other.Timeout != 0 {
+		c.Timeout = other.Timeout
+	}
+	if other.ContextWindow != 0 {
+		c.ContextWindow = other.ContextWindow
+	}
+	if other.Transport != nil {
+		c.Transport = other.Transport
+	}
+	if other.Tracing != nil {
+		c.Tracing = other.Tracing
+	}
+
+	return c
+}
@@ -0,0 +1,302 @@
+// Package models builds the chat and embedding models of the examples from a Config,
+// so switching between Ollama, OpenAI or a fake is a configuration change.
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/nikolayk812/genai-go/internal/fake"
+	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	"github.com/nikolayk812/genai-go/internal/tracing"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// ErrUnknownProvider is returned for a provider which is not registered
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// ErrUnsupported is returned when a provider cannot build the requested kind of model
+var ErrUnsupported = errors.New("unsupported by the provider")
+
+// Provider builds the models of a backend, either func may be nil when it is unsupported
+type Provider struct {
+	NewModel    func(cfg ModelConfig, httpCli *http.Client) (llms.Model, error)
+	NewEmbedder func(cfg ModelConfig, httpCli *http.Client) (embeddings.EmbedderClient, error)
+}
+
+// Middleware wraps the next round tripper, which is nil for the innermost one
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+var (
+	mu         sync.RWMutex
+	providers  = map[string]Provider{}
+	transports = map[string]Middleware{}
+)
+
+func init() {
+	Register("ollama", Provider{NewModel: newOllamaModel, NewEmbedder: newOllamaEmbedder})
+	Register("openai", Provider{NewModel: newOpenAIModel, NewEmbedder: newOpenAIEmbedder})
+	// the fake echoes the prompts, to run the examples without a model server
+	Register("fake", Provider{
+		NewModel: func(ModelConfig, *http.Client) (llms.Model, error) {
+			return fake.NewModel(fake.WithEcho()), nil
+		},
+		NewEmbedder: func(ModelConfig, *http.Client) (embeddings.EmbedderClient, error) {
+			return fake.NewModel(), nil
+		},
+	})
+
+	RegisterTransport("logging", func(next http.RoundTripper) http.RoundTripper {
+		return internalhttp.NewLoggingRoundTripper(internalhttp.WithTransport(next), internalhttp.WithExportFromEnv())
+	})
+	RegisterTransport("retry", func(next http.RoundTripper) http.RoundTripper {
+		return internalhttp.NewRetryRoundTripper(next)
+	})
+	RegisterTransport("breaker", func(next http.RoundTripper) http.RoundTripper {
+		return internalhttp.NewCircuitBreakerRoundTripper(next)
+	})
+	RegisterTransport("tracing", func(next http.RoundTripper) http.RoundTripper {
+		return internalhttp.NewTracingRoundTripper(next)
+	})
+}
+
+// Register makes a provider available to the configuration under name, replacing any previous one
+func Register(name string, provider Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	providers[name] = provider
+}
+
+// RegisterTransport makes a middleware available to the transport chain of the configuration under name
+func RegisterTransport(name string, middleware Middleware) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	transports[name] = middleware
+}
+
+// Providers returns the sorted names of the registered providers
+func Providers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(providers))
+}
+
+func provider(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return Provider{}, fmt.Errorf("%w %q, registered: %v", ErrUnknownProvider, name, slices.Sorted(maps.Keys(providers)))
+	}
+
+	return p, nil
+}
+
+// Option is a functional option for NewModel and NewEmbedder
+type Option func(*options)
+
+type options struct {
+	httpCli *http.Client
+}
+
+// WithHTTPClient replaces the client built from the timeout and the transport chain of the configuration,
+// e.g. for the tests which add a cache or a cassette
+func WithHTTPClient(httpCli *http.Client) Option {
+	return func(o *options) {
+		o.httpCli = httpCli
+	}
+}
+
+// NewModel builds the chat model of the configuration
+func NewModel(cfg ModelConfig, opts ...Option) (llms.Model, error) {
+	p, err := provider(cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if p.NewModel == nil {
+		return nil, fmt.Errorf("%s chat model: %w", cfg.Provider, ErrUnsupported)
+	}
+
+	httpCli, err := httpClient(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := p.NewModel(cfg, httpCli)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Provider, err)
+	}
+
+	if cfg.TracingEnabled() {
+		return tracing.NewModel(model), nil
+	}
+
+	return model, nil
+}
+
+// NewEmbedder builds the embedding model of the configuration, to be used with embeddings.NewEmbedder
+func NewEmbedder(cfg ModelConfig, opts ...Option) (embeddings.EmbedderClient, error) {
+	p, err := provider(cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if p.NewEmbedder == nil {
+		return nil, fmt.Errorf("%s embedder: %w", cfg.Provider, ErrUnsupported)
+	}
+
+	httpCli, err := httpClient(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	embedder, err := p.NewEmbedder(cfg, httpCli)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Provider, err)
+	}
+
+	if cfg.TracingEnabled() {
+		return tracing.NewEmbedderClient(embedder), nil
+	}
+
+	return embedder, nil
+}
+
+func httpClient(cfg ModelConfig, opts []Option) (*http.Client, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.httpCli != nil {
+		return o.httpCli, nil
+	}
+
+	return NewHTTPClient(cfg)
+}
+
+// NewHTTPClient builds the client of the configuration: its timeout and transport chain
+func NewHTTPClient(cfg ModelConfig) (*http.Client, error) {
+	chain := cfg.Transport
+	if chain == nil {
+		chain = DefaultTransport
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var transport http.RoundTripper
+	for _, name := range slices.Backward(chain) {
+		middleware, ok := transports[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transport %q, registered: %v", name, slices.Sorted(maps.Keys(transports)))
+		}
+		transport = middleware(transport)
+	}
+
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}, nil
+}
+
+func newOllamaModel(cfg ModelConfig, httpCli *http.Client) (llms.Model, error) {
+	llm, err := newOllama(cfg, httpCli)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ollamaModel{LLM: llm}, nil
+}
+
+// ollamaModel adds the LoadDuration and EvalDuration reported by Ollama, which langchaingo does not return,
+// to the GenerationInfo of the choices. They are recorded by the logging transport, so they are missing
+// when the transport chain does not have it.
+type ollamaModel struct {
+	*ollama.LLM
+}
+
+func (m *ollamaModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var timings internalhttp.ServerTimings
+	resp, err := m.LLM.GenerateContent(internalhttp.WithServerTimings(ctx, &timings), messages, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, choice := range resp.Choices {
+		if choice.GenerationInfo == nil {
+			choice.GenerationInfo = map[string]any{}
+		}
+		choice.GenerationInfo["LoadDuration"] = timings.LoadDuration
+		choice.GenerationInfo["EvalDuration"] = timings.EvalDuration
+	}
+
+	return resp, nil
+}
+
+func (m *ollamaModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func newOllamaEmbedder(cfg ModelConfig, httpCli *http.Client) (embeddings.EmbedderClient, error) {
+	return newOllama(cfg, httpCli)
+}
+
+func newOllama(cfg ModelConfig, httpCli *http.Client) (*ollama.LLM, error) {
+	url := cfg.URL
+	if url == "" {
+		url = DefaultOllamaURL
+	}
+
+	opts := []ollama.Option{
+		ollama.WithModel(cfg.Model),
+		ollama.WithServerURL(url),
+		ollama.WithHTTPClient(httpCli),
+	}
+	if cfg.ContextWindow > 0 {
+		opts = append(opts, ollama.WithRunnerNumCtx(cfg.ContextWindow))
+	}
+
+	llm, err := ollama.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("ollama.New: %w", err)
+	}
+
+	return llm, nil
+}
+
+func newOpenAIModel(cfg ModelConfig, httpCli *http.Client) (llms.Model, error) {
+	return newOpenAI(cfg, httpCli, openai.WithModel(cfg.Model))
+}
+
+func newOpenAIEmbedder(cfg ModelConfig, httpCli *http.Client) (embeddings.EmbedderClient, error) {
+	return newOpenAI(cfg, httpCli, openai.WithEmbeddingModel(cfg.Model))
+}
+
+func newOpenAI(cfg ModelConfig, httpCli *http.Client, model openai.Option) (*openai.LLM, error) {
+	token := cfg.Token
+	if token == "" {
+		token = os.Getenv("OPENAI_API_KEY")
+	}
+
+	opts := []openai.Option{model, openai.WithToken(token), openai.WithHTTPClient(httpCli)}
+	if cfg.URL != "" {
+		opts = append(opts, openai.WithBaseURL(cfg.URL))
+	}
+
+	llm, err := openai.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("openai.New: %w", err)
+	}
+
+	return llm, nil
+}
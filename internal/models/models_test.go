@@ -0,0 +1,179 @@
+package models
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestLoadFile(t *testing.T) {
+	t.Setenv("TEST_LLM_TOKEN", "secret")
+
+	path := filepath.Join(t.TempDir(), "llm.yaml")
+	data := `
+chat:
+  provider: openai
+  model: gpt-4o-mini
+  token: ${TEST_LLM_TOKEN}
+  timeout: 2m
+embedding:
+  transport: []
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %s", err)
+	}
+
+	cfg, err := LoadFile(path, Config{Chat: Ollama("llama3.2"), Embedding: Ollama("nomic-embed-text:v1.5")})
+	if err != nil {
+		t.Fatalf("LoadFile: %s", err)
+	}
+
+	// the Ollama URL is not kept for OpenAI
+	want := ModelConfig{Provider: "openai", Model: "gpt-4o-mini", Token: "secret", Timeout: 2 * time.Minute}
+	if !equal(cfg.Chat, want) {
+		t.Fatalf("chat config is %+v, want %+v", cfg.Chat, want)
+	}
+
+	if cfg.Embedding.Model != "nomic-embed-text:v1.5" || cfg.Embedding.Transport == nil || len(cfg.Embedding.Transport) > 0 {
+		t.Fatalf("unexpected embedding config: %+v", cfg.Embedding)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LLM_MODEL", "llama3.1")
+	t.Setenv("LLM_TRANSPORT", "breaker, retry")
+	t.Setenv("LLM_EMBEDDING_CONTEXT_WINDOW", "8192")
+
+	cfg, err := ConfigFromEnv(Config{Chat: Ollama("llama3.2"), Embedding: Ollama("nomic-embed-text:v1.5")})
+	if err != nil {
+		t.Fatalf("ConfigFromEnv: %s", err)
+	}
+
+	if cfg.Chat.Model != "llama3.1" || cfg.Chat.URL != DefaultOllamaURL || !slices.Equal(cfg.Chat.Transport, []string{"breaker", "retry"}) {
+		t.Fatalf("unexpected chat config: %+v", cfg.Chat)
+	}
+	if cfg.Embedding.ContextWindow != 8192 || cfg.Embedding.Transport != nil {
+		t.Fatalf("unexpected embedding config: %+v", cfg.Embedding)
+	}
+
+	t.Setenv("LLM_TRACING", "maybe")
+	if _, err := ConfigFromEnv(Config{}); err == nil {
+		t.Fatalf("invalid LLM_TRACING is accepted")
+	}
+	t.Setenv("LLM_TRACING", "")
+
+	t.Setenv("LLM_TIMEOUT", "soon")
+	if _, err := ConfigFromEnv(Config{}); err == nil {
+		t.Fatalf("invalid LLM_TIMEOUT is accepted")
+	}
+}
+
+func TestLoad_tracingOff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm.yaml")
+	if err := os.WriteFile(path, []byte("chat:\n  tracing: true\nembedding:\n  tracing: true\n"), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %s", err)
+	}
+	t.Setenv("LLM_CONFIG", path)
+	t.Setenv("LLM_TRACING", "false")
+
+	cfg, err := Load(Config{Chat: Ollama("llama3.2"), Embedding: Ollama("nomic-embed-text:v1.5")})
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+
+	// the environment is the last layer, so it turns off the tracing enabled by the file
+	if cfg.Chat.TracingEnabled() || !cfg.Embedding.TracingEnabled() {
+		t.Fatalf("tracing is %t for chat and %t for embedding, want false and true",
+			cfg.Chat.TracingEnabled(), cfg.Embedding.TracingEnabled())
+	}
+}
+
+func TestNewModel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Hello!"},"done":true}`)
+	}))
+	defer srv.Close()
+
+	cfg := Ollama("llama3.2")
+	cfg.URL = srv.URL
+	cfg.Transport = []string{"breaker", "retry"}
+
+	llm, err := NewModel(cfg)
+	if err != nil {
+		t.Fatalf("NewModel: %s", err)
+	}
+
+	answer, err := llm.Call(t.Context(), "Hello")
+	if err != nil {
+		t.Fatalf("Call: %s", err)
+	}
+	if answer != "Hello!" {
+		t.Fatalf("answer is %q, want Hello!", answer)
+	}
+
+	if _, err := NewModel(ModelConfig{Provider: "llamafile"}); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("error is %v, want ErrUnknownProvider", err)
+	}
+
+	cfg.Transport = []string{"compression"}
+	if _, err := NewEmbedder(cfg); err == nil {
+		t.Fatalf("unknown transport is accepted")
+	}
+}
+
+func TestNewModel_ollamaDurations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Hello!"},"done":true,"load_duration":48000000,"eval_duration":311000000}`)
+	}))
+	defer srv.Close()
+
+	cfg := Ollama("llama3.2")
+	cfg.URL = srv.URL
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	httpCli := &http.Client{Transport: internalhttp.NewLoggingRoundTripper(internalhttp.WithLogger(logger))}
+
+	llm, err := NewModel(cfg, WithHTTPClient(httpCli))
+	if err != nil {
+		t.Fatalf("NewModel: %s", err)
+	}
+
+	resp, err := llm.GenerateContent(t.Context(), []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "Hello")})
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+
+	usage := internalllms.ResponseUsage(resp)
+	if usage.LoadDuration != 48*time.Millisecond || usage.EvalDuration != 311*time.Millisecond {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func equal(a, b ModelConfig) bool {
+	return a.Provider == b.Provider && a.Model == b.Model && a.URL == b.URL && a.Token == b.Token &&
+		a.Timeout == b.Timeout && a.ContextWindow == b.ContextWindow && slices.Equal(a.Transport, b.Transport) && a.TracingEnabled() == b.TracingEnabled()
+}
+
+func TestNewModel_fake(t *testing.T) {
+	llm, err := NewModel(ModelConfig{Provider: "fake"})
+	if err != nil {
+		t.Fatalf("NewModel: %s", err)
+	}
+
+	if answer, err := llm.Call(t.Context(), "Hello"); err != nil || answer != "Hello" {
+		t.Fatalf("answer is %q, %v, want the echo", answer, err)
+	}
+}
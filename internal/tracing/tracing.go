@@ -0,0 +1,223 @@
+// Package tracing wraps the langchaingo models and vector stores with OpenTelemetry spans, so a RAG flow
+// shows up as a single trace: the embedding of the query and the similarity search, followed by the generation.
+// Combined with internalhttp.TracingRoundTripper, the HTTP calls to the model server become child spans.
+package tracing
+
+import (
+	"context"
+
+	internalllms "github.com/nikolayk812/genai-go/internal/llms"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/nikolayk812/genai-go/internal/tracing"
+
+// Option is a functional option for the traced wrappers
+type Option func(*options)
+
+type options struct {
+	provider    trace.TracerProvider
+	spanOptions []trace.SpanStartOption
+}
+
+// WithTracerProvider sets the tracer provider, otel.GetTracerProvider() by default
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.provider = provider
+	}
+}
+
+// WithSpanStartOptions sets the options of the span started by Start, e.g. trace.WithAttributes
+func WithSpanStartOptions(opts ...trace.SpanStartOption) Option {
+	return func(o *options) {
+		o.spanOptions = append(o.spanOptions, opts...)
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.provider == nil {
+		o.provider = otel.GetTracerProvider()
+	}
+
+	return o
+}
+
+func newTracer(opts []Option) trace.Tracer {
+	return newOptions(opts).provider.Tracer(instrumentationName)
+}
+
+// Start starts a span with the tracer of this package, it is meant for the application code
+// calling the models, e.g. a chat service, to become the parent of the model spans.
+func Start(ctx context.Context, name string, opts ...Option) (context.Context, trace.Span) {
+	o := newOptions(opts)
+	return o.provider.Tracer(instrumentationName).Start(ctx, name, o.spanOptions...)
+}
+
+// End records the error, if any, and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Model wraps a llms.Model with a span for every GenerateContent call
+type Model struct {
+	model  llms.Model
+	tracer trace.Tracer
+}
+
+var _ llms.Model = (*Model)(nil)
+
+func NewModel(model llms.Model, opts ...Option) *Model {
+	return &Model{model: model, tracer: newTracer(opts)}
+}
+
+func (m *Model) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	callOpts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&callOpts)
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("gen_ai.operation.name", "chat"),
+		attribute.Int("gen_ai.request.messages", len(messages)),
+		attribute.Float64("gen_ai.request.temperature", callOpts.Temperature),
+		attribute.Bool("gen_ai.request.streaming", callOpts.StreamingFunc != nil),
+	}
+	if callOpts.Model != "" {
+		attrs = append(attrs, attribute.String("gen_ai.request.model", callOpts.Model))
+	}
+	if callOpts.TopK != 0 {
+		attrs = append(attrs, attribute.Int("gen_ai.request.top_k", callOpts.TopK))
+	}
+	if callOpts.Seed != 0 {
+		attrs = append(attrs, attribute.Int("gen_ai.request.seed", callOpts.Seed))
+	}
+	if callOpts.MaxTokens != 0 {
+		attrs = append(attrs, attribute.Int("gen_ai.request.max_tokens", callOpts.MaxTokens))
+	}
+
+	ctx, span := m.tracer.Start(ctx, "llms.GenerateContent", trace.WithAttributes(attrs...))
+
+	resp, err := m.model.GenerateContent(ctx, messages, options...)
+	if err == nil && resp != nil {
+		span.SetAttributes(responseAttributes(resp)...)
+	}
+
+	End(span, err)
+
+	return resp, err
+}
+
+func (m *Model) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func responseAttributes(resp *llms.ContentResponse) []attribute.KeyValue {
+	var stopReasons []string
+	for _, choice := range resp.Choices {
+		if choice != nil && choice.StopReason != "" {
+			stopReasons = append(stopReasons, choice.StopReason)
+		}
+	}
+
+	usage := internalllms.ResponseUsage(resp)
+
+	attrs := []attribute.KeyValue{
+		attribute.Int("gen_ai.response.choices", len(resp.Choices)),
+		attribute.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+	}
+	if len(stopReasons) > 0 {
+		attrs = append(attrs, attribute.StringSlice("gen_ai.response.finish_reasons", stopReasons))
+	}
+
+	return attrs
+}
+
+// EmbedderClient wraps an embeddings.EmbedderClient with a span for every CreateEmbedding call
+type EmbedderClient struct {
+	client embeddings.EmbedderClient
+	tracer trace.Tracer
+}
+
+var _ embeddings.EmbedderClient = (*EmbedderClient)(nil)
+
+func NewEmbedderClient(client embeddings.EmbedderClient, opts ...Option) *EmbedderClient {
+	return &EmbedderClient{client: client, tracer: newTracer(opts)}
+}
+
+func (e *EmbedderClient) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	ctx, span := e.tracer.Start(ctx, "embeddings.CreateEmbedding", trace.WithAttributes(
+		attribute.String("gen_ai.operation.name", "embeddings"),
+		attribute.Int("gen_ai.request.texts", len(texts)),
+	))
+
+	vectors, err := e.client.CreateEmbedding(ctx, texts)
+	if err == nil && len(vectors) > 0 {
+		span.SetAttributes(attribute.Int("gen_ai.embeddings.dimension", len(vectors[0])))
+	}
+
+	End(span, err)
+
+	return vectors, err
+}
+
+// VectorStore wraps a vectorstores.VectorStore with a span for every call
+type VectorStore struct {
+	store  vectorstores.VectorStore
+	tracer trace.Tracer
+}
+
+var _ vectorstores.VectorStore = (*VectorStore)(nil)
+
+func NewVectorStore(store vectorstores.VectorStore, opts ...Option) *VectorStore {
+	return &VectorStore{store: store, tracer: newTracer(opts)}
+}
+
+func (v *VectorStore) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	ctx, span := v.tracer.Start(ctx, "vectorstores.AddDocuments", trace.WithAttributes(
+		attribute.Int("db.vector.documents", len(docs)),
+	))
+
+	ids, err := v.store.AddDocuments(ctx, docs, options...)
+
+	End(span, err)
+
+	return ids, err
+}
+
+func (v *VectorStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	opts := vectorstores.Options{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	ctx, span := v.tracer.Start(ctx, "vectorstores.SimilaritySearch", trace.WithAttributes(
+		attribute.Int("db.vector.query.top_k", numDocuments),
+		attribute.Float64("db.vector.query.score_threshold", float64(opts.ScoreThreshold)),
+	))
+
+	docs, err := v.store.SimilaritySearch(ctx, query, numDocuments, options...)
+	if err == nil {
+		span.SetAttributes(attribute.Int("db.vector.query.results", len(docs)))
+	}
+
+	End(span, err)
+
+	return docs, err
+}
@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	internalhttp "github.com/nikolayk812/genai-go/internal/http"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeStore struct{}
+
+func (fakeStore) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	return make([]string, len(docs)), nil
+}
+
+func (fakeStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	return []schema.Document{{PageContent: "I like football"}}, nil
+}
+
+func TestRAGTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Football"},"done_reason":"stop","done":true,"prompt_eval_count":26,"eval_count":8}`)
+	}))
+	defer srv.Close()
+
+	httpCli := &http.Client{
+		Transport: internalhttp.NewTracingRoundTripper(nil, internalhttp.WithTracerProvider(provider)),
+	}
+
+	llm, err := ollama.New(
+		ollama.WithModel("llama3.2"),
+		ollama.WithServerURL(srv.URL),
+		ollama.WithHTTPClient(httpCli),
+	)
+	if err != nil {
+		t.Fatalf("ollama.New: %s", err)
+	}
+
+	model := NewModel(llm, WithTracerProvider(provider))
+	store := NewVectorStore(fakeStore{}, WithTracerProvider(provider))
+
+	ctx, span := Start(t.Context(), "rag", WithTracerProvider(provider))
+
+	if _, err := store.SimilaritySearch(ctx, "What is my favorite sport?", 1); err != nil {
+		t.Fatalf("SimilaritySearch: %s", err)
+	}
+
+	_, err = model.GenerateContent(ctx, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "What is my favorite sport?"),
+	}, llms.WithTemperature(0), llms.WithSeed(42))
+	if err != nil {
+		t.Fatalf("GenerateContent: %s", err)
+	}
+
+	span.End()
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+
+	root := spans["rag"]
+	search := spans["vectorstores.SimilaritySearch"]
+	generate := spans["llms.GenerateContent"]
+	call := spans["chat llama3.2"]
+
+	if search.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("SimilaritySearch is not a child of the rag span: %+v", spans)
+	}
+	if generate.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("GenerateContent is not a child of the rag span: %+v", spans)
+	}
+	if call.Parent.SpanID() != generate.SpanContext.SpanID() {
+		t.Errorf("HTTP span is not a child of GenerateContent: %+v", spans)
+	}
+
+	for _, want := range []attribute.KeyValue{
+		attribute.String("gen_ai.request.model", "llama3.2"),
+		attribute.Float64("gen_ai.request.temperature", 0),
+		attribute.Int("gen_ai.request.seed", 42),
+		attribute.Int("gen_ai.usage.input_tokens", 26),
+		attribute.Int("gen_ai.usage.output_tokens", 8),
+		attribute.StringSlice("gen_ai.response.finish_reasons", []string{"stop"}),
+	} {
+		if !hasAttribute(call.Attributes, want) {
+			t.Errorf("HTTP span does not have %s=%s: %v", want.Key, want.Value.Emit(), call.Attributes)
+		}
+	}
+
+	if !hasAttribute(generate.Attributes, attribute.Int("gen_ai.usage.output_tokens", 8)) {
+		t.Errorf("GenerateContent span does not have the output tokens: %v", generate.Attributes)
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a.Key == want.Key && a.Value.Emit() == want.Value.Emit() {
+			return true
+		}
+	}
+	return false
+}